@@ -0,0 +1,59 @@
+package dsl
+
+import (
+	"strings"
+)
+
+// sharedAncestors returns the ancestors that the field paths of all the tags of the
+// SAMEPARENT expression have in common, at most exp.Depth segments above each field
+// path, and the matched field paths of each tag. A field path is its own ancestor,
+// so with depth 0 the field paths must be the same. The shared ancestors are empty
+// if any of the tags was not found.
+func (exp *Expression) sharedAncestors(
+	fieldPathByTag map[string][]string,
+	opts SolveOptions,
+) (shared map[string]struct{}, matchedByOperand [][]string) {
+	for i, operand := range exp.Exprs {
+		matched := matchedFieldPaths(operand.Tag, fieldPathByTag[operand.Tag.Name], opts)
+		matchedByOperand = append(matchedByOperand, matched)
+
+		operandAncestors := make(map[string]struct{})
+		for _, fieldPath := range matched {
+			for _, ancestor := range fieldPathAncestors(fieldPath, exp.Depth) {
+				if _, ok := shared[ancestor]; ok || i == 0 {
+					operandAncestors[ancestor] = struct{}{}
+				}
+			}
+		}
+		shared = operandAncestors
+		if len(shared) == 0 {
+			return nil, nil
+		}
+	}
+	return shared, matchedByOperand
+}
+
+// colocatedFieldPaths returns the field paths that have one of the ancestors.
+func colocatedFieldPaths(fieldPaths []string, ancestors map[string]struct{}, depth int) (colocated []string) {
+	for _, fieldPath := range fieldPaths {
+		for _, ancestor := range fieldPathAncestors(fieldPath, depth) {
+			if _, ok := ancestors[ancestor]; ok {
+				colocated = append(colocated, fieldPath)
+				break
+			}
+		}
+	}
+	return
+}
+
+// fieldPathAncestors returns the field path and its ancestors up to depth segments
+// above it, the root (empty path) is not included.
+// Eg: for "a.b.c" with depth 1 returns "a.b.c" and "a.b"
+func fieldPathAncestors(fieldPath string, depth int) []string {
+	segments := strings.Split(fieldPath, ".")
+	ancestors := []string{fieldPath}
+	for k := len(segments) - 1; k >= 1 && k >= len(segments)-depth; k-- {
+		ancestors = append(ancestors, strings.Join(segments[:k], "."))
+	}
+	return ancestors
+}
@@ -0,0 +1,46 @@
+package dsl
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFieldPathAncestors(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([]string{"a.b.c"}, fieldPathAncestors("a.b.c", 0), "depth 0")
+	assert.Equal([]string{"a.b.c", "a.b"}, fieldPathAncestors("a.b.c", 1), "depth 1")
+	assert.Equal([]string{"a.b.c", "a.b", "a"}, fieldPathAncestors("a.b.c", 5), "root is not included")
+	assert.Equal([]string{"a"}, fieldPathAncestors("a", 1), "single segment")
+}
+
+func TestExplainColocation(t *testing.T) {
+	assert := assert.New(t)
+	exp, err := NewParser(strings.NewReader(`sameparent("name", "ssn", 1)`)).Parse()
+	assert.Nil(err)
+
+	fieldPathByTag := map[string][]string{
+		"name": {"customers.index(0).name", "customers.index(1).name", "employees.index(0).name"},
+		"ssn":  {"customers.index(1).ssn", "customers.index(2).ssn"},
+	}
+	expl, err := exp.Explain(fieldPathByTag)
+	assert.Nil(err)
+	assert.Equal(`SAMEPARENT 1: true
+    name: true (customers.index(1).name)
+    ssn: true (customers.index(1).ssn)
+`, expl.PrettyFormat(), "pretty format")
+
+	delete(fieldPathByTag, "ssn")
+	expl, err = exp.Explain(fieldPathByTag)
+	assert.Nil(err)
+	assert.Equal(`SAMEPARENT 1: false
+    name: false
+    ssn: false
+`, expl.PrettyFormat(), "missing tag")
+
+	assert.Equal(`SAMEPARENT 1
+    name
+    ssn
+`, exp.PrettyFormat(), "expression pretty format")
+}
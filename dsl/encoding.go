@@ -0,0 +1,195 @@
+package dsl
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// encodedExpression is the representation of the Expression used on the JSON and YAML encoding.
+type encodedExpression struct {
+	Type     ExprType      `json:"type" yaml:"type"`
+	Tag      *TagInfo      `json:"tag,omitempty" yaml:"tag,omitempty"`
+	LExpr    *Expression   `json:"lExpr,omitempty" yaml:"lExpr,omitempty"`
+	RExpr    *Expression   `json:"rExpr,omitempty" yaml:"rExpr,omitempty"`
+	Exprs    []*Expression `json:"exprs,omitempty" yaml:"exprs,omitempty"`
+	Operator CompareOp     `json:"operator,omitempty" yaml:"operator,omitempty"`
+	Count    int           `json:"count,omitempty" yaml:"count,omitempty"`
+	Depth    int           `json:"depth,omitempty" yaml:"depth,omitempty"`
+	RuleName string        `json:"ruleName,omitempty" yaml:"ruleName,omitempty"`
+}
+
+// MarshalJSON returns the readable name of the ExprType as a JSON string.
+func (exprType ExprType) MarshalJSON() ([]byte, error) {
+	return json.Marshal(exprType.GetName())
+}
+
+// UnmarshalJSON sets the ExprType from its readable name.
+func (exprType *ExprType) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	return exprType.setName(name)
+}
+
+// MarshalYAML returns the readable name of the ExprType.
+func (exprType ExprType) MarshalYAML() (interface{}, error) {
+	return exprType.GetName(), nil
+}
+
+// UnmarshalYAML sets the ExprType from its readable name.
+func (exprType *ExprType) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err != nil {
+		return err
+	}
+	return exprType.setName(name)
+}
+
+// setName sets the ExprType that has the given readable name.
+func (exprType *ExprType) setName(name string) error {
+	for t := UNSET_EXPR; t.GetName() != "UNEXPECTED"; t++ {
+		if t.GetName() == name {
+			*exprType = t
+			return nil
+		}
+	}
+	return fmt.Errorf("unexpected expression type %q", name)
+}
+
+// MarshalJSON returns the expression as a JSON tree with the readable names of the types.
+// Eg: for the expression "a:field" and not "b"
+//    {"type":"AND","lExpr":{"type":"UNIT","tag":{"name":"a","fieldPath":"field"}},
+//     "rExpr":{"type":"NOT","rExpr":{"type":"UNIT","tag":{"name":"b"}}}}
+func (exp Expression) MarshalJSON() ([]byte, error) {
+	return json.Marshal(exp.encode())
+}
+
+// UnmarshalJSON sets the expression from a JSON tree returned by MarshalJSON.
+// Returns an error if any of the expressions is missing the values needed by its type.
+func (exp *Expression) UnmarshalJSON(data []byte) error {
+	var encoded encodedExpression
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	return exp.decode(encoded)
+}
+
+// MarshalYAML returns the expression as a YAML tree with the same structure of MarshalJSON.
+func (exp Expression) MarshalYAML() (interface{}, error) {
+	return exp.encode(), nil
+}
+
+// UnmarshalYAML sets the expression from a YAML tree returned by MarshalYAML.
+// Returns an error if any of the expressions is missing the values needed by its type.
+func (exp *Expression) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var encoded encodedExpression
+	if err := unmarshal(&encoded); err != nil {
+		return err
+	}
+	return exp.decode(encoded)
+}
+
+// encode returns the encodedExpression of the expression.
+func (exp Expression) encode() encodedExpression {
+	encoded := encodedExpression{
+		Type:     exp.Type,
+		LExpr:    exp.LExpr,
+		RExpr:    exp.RExpr,
+		Exprs:    exp.Exprs,
+		Operator: exp.Operator,
+		Count:    exp.Count,
+		Depth:    exp.Depth,
+		RuleName: exp.RuleName,
+	}
+	if exp.Type == UNIT_EXPR || exp.Type == COUNT_EXPR {
+		tag := exp.Tag
+		encoded.Tag = &tag
+	}
+	return encoded
+}
+
+// decode sets the expression from the encodedExpression and validates it.
+func (exp *Expression) decode(encoded encodedExpression) error {
+	*exp = Expression{
+		Type:     encoded.Type,
+		LExpr:    encoded.LExpr,
+		RExpr:    encoded.RExpr,
+		Exprs:    encoded.Exprs,
+		Operator: encoded.Operator,
+		Count:    encoded.Count,
+		Depth:    encoded.Depth,
+		RuleName: encoded.RuleName,
+	}
+	if encoded.Tag != nil {
+		exp.Tag = *encoded.Tag
+	}
+	return exp.validateNode()
+}
+
+// validateNode returns an error if the expression is missing the values needed by its type.
+// The sub expressions are not validated.
+func (exp *Expression) validateNode() error {
+	switch exp.Type {
+	case UNIT_EXPR:
+		if exp.Tag.Name == "" {
+			return fmt.Errorf("UNIT statement do not have tag: %v", exp)
+		}
+		if err := ValidateFieldPath(exp.Tag.FieldPath); err != nil {
+			return err
+		}
+	case AND_EXPR, OR_EXPR:
+		if exp.LExpr == nil || exp.RExpr == nil {
+			return fmt.Errorf("%s statement do not have right or left expression: %v", exp.GetTypeName(), exp)
+		}
+	case NOT_EXPR:
+		if exp.RExpr == nil {
+			return fmt.Errorf("NOT statement do not have expression: %v", exp)
+		}
+	case TRUE_EXPR, FALSE_EXPR:
+	case ATLEAST_EXPR:
+		if len(exp.Exprs) == 0 {
+			return fmt.Errorf("ATLEAST statement do not have expressions: %v", exp)
+		}
+		for _, operand := range exp.Exprs {
+			if operand == nil {
+				return fmt.Errorf("ATLEAST statement have a nil expression: %v", exp)
+			}
+		}
+		if exp.Count < 1 || exp.Count > len(exp.Exprs) {
+			return fmt.Errorf("ATLEAST count must be between 1 and the number of expressions (%d): %v", len(exp.Exprs), exp)
+		}
+	case COUNT_EXPR:
+		if exp.Tag.Name == "" {
+			return fmt.Errorf("COUNT statement do not have tag: %v", exp)
+		}
+		if err := ValidateFieldPath(exp.Tag.FieldPath); err != nil {
+			return err
+		}
+		if exp.Operator == UNSET_OP || exp.Operator.GetName() == "UNEXPECTED" {
+			return fmt.Errorf("COUNT statement do not have a valid operator: %v", exp)
+		}
+		if exp.Count < 0 {
+			return fmt.Errorf("COUNT statement can not be compared with a negative number: %v", exp)
+		}
+	case SAMEPARENT_EXPR:
+		if len(exp.Exprs) < 2 {
+			return fmt.Errorf("SAMEPARENT statement needs at least 2 tags: %v", exp)
+		}
+		for _, operand := range exp.Exprs {
+			if operand == nil || operand.Type != UNIT_EXPR {
+				return fmt.Errorf("SAMEPARENT statement can only have tags: %v", exp)
+			}
+		}
+		if exp.Depth < 0 {
+			return fmt.Errorf("SAMEPARENT statement can not have a negative depth: %v", exp)
+		}
+	case RULE_EXPR:
+		if exp.RuleName == "" {
+			return fmt.Errorf("RULE statement do not have rule name: %v", exp)
+		}
+	default:
+		return fmt.Errorf("unable to process expression type %d", exp.Type)
+	}
+	return nil
+}
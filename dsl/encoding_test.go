@@ -0,0 +1,187 @@
+package dsl
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestMarshalJSON(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		expStr       string
+		expectedJSON string
+		message      string
+	}{
+		{
+			expStr:       `"tag1"`,
+			expectedJSON: `{"type":"UNIT","tag":{"name":"tag1"}}`,
+			message:      "single tag",
+		},
+		{
+			expStr: `"tag1:field1" and not ("tag2" or "tag3")`,
+			expectedJSON: `{"type":"AND",` +
+				`"lExpr":{"type":"UNIT","tag":{"name":"tag1","fieldPath":"field1"}},` +
+				`"rExpr":{"type":"NOT","rExpr":{"type":"OR",` +
+				`"lExpr":{"type":"UNIT","tag":{"name":"tag2"}},` +
+				`"rExpr":{"type":"UNIT","tag":{"name":"tag3"}}}}}`,
+			message: "multiple expressions",
+		},
+		{
+			expStr: `atleast(1, "tag1", count("tag2:field2") >= 2)`,
+			expectedJSON: `{"type":"ATLEAST","exprs":[` +
+				`{"type":"UNIT","tag":{"name":"tag1"}},` +
+				`{"type":"COUNT","tag":{"name":"tag2","fieldPath":"field2"},"operator":"\u003e=","count":2}` +
+				`],"count":1}`,
+			message: "quantifiers",
+		},
+	}
+
+	for _, tc := range tests {
+		exp, err := NewParser(strings.NewReader(tc.expStr)).Parse()
+		assert.Nil(err, tc.message)
+		data, err := json.Marshal(exp)
+		assert.Nil(err, tc.message)
+		assert.Equal(tc.expectedJSON, string(data), tc.message)
+
+		var unmarshaled Expression
+		err = json.Unmarshal(data, &unmarshaled)
+		assert.Nil(err, tc.message)
+		assert.Equal(*exp, unmarshaled, tc.message)
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+	for _, tc := range solverTestCases {
+		exp, err := NewParser(strings.NewReader(tc.expStr)).Parse()
+		assert.Nil(err, tc.message)
+
+		jsonData, err := json.Marshal(exp)
+		assert.Nil(err, tc.message+" json")
+		jsonExp := &Expression{}
+		err = json.Unmarshal(jsonData, jsonExp)
+		assert.Nil(err, tc.message+" json")
+		assert.Equal(exp, jsonExp, tc.message+" json")
+
+		yamlData, err := yaml.Marshal(exp)
+		assert.Nil(err, tc.message+" yaml")
+		yamlExp := &Expression{}
+		err = yaml.Unmarshal(yamlData, yamlExp)
+		assert.Nil(err, tc.message+" yaml")
+		assert.Equal(exp, yamlExp, tc.message+" yaml")
+	}
+}
+
+func TestMarshalYAML(t *testing.T) {
+	assert := assert.New(t)
+	exp, err := NewParser(strings.NewReader(`not "tag1:field1"`)).Parse()
+	assert.Nil(err)
+	data, err := yaml.Marshal(exp)
+	assert.Nil(err)
+	assert.Equal("type: NOT\nrExpr:\n    type: UNIT\n    tag:\n        name: tag1\n        fieldPath: field1\n", string(data))
+}
+
+func TestUnmarshalInvalid(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		data        string
+		expectedErr error
+		message     string
+	}{
+		{
+			data:        `{"type":"XOR"}`,
+			expectedErr: fmt.Errorf("unexpected expression type \"XOR\""),
+			message:     "unknown type",
+		},
+		{
+			data:        `{"type":"UNSET"}`,
+			expectedErr: fmt.Errorf("unable to process expression type 0"),
+			message:     "unset type",
+		},
+		{
+			data:        `{"type":"UNIT"}`,
+			expectedErr: fmt.Errorf("UNIT statement do not have tag: \"\""),
+			message:     "unit without tag",
+		},
+		{
+			data:        `{"type":"AND","lExpr":{"type":"UNIT","tag":{"name":"tag1"}}}`,
+			expectedErr: fmt.Errorf("AND statement do not have right or left expression: \"tag1\" and "),
+			message:     "and without right expression",
+		},
+		{
+			data:        `{"type":"OR","rExpr":{"type":"UNIT","tag":{"name":"tag1"}}}`,
+			expectedErr: fmt.Errorf("OR statement do not have right or left expression:  or \"tag1\""),
+			message:     "or without left expression",
+		},
+		{
+			data:        `{"type":"NOT"}`,
+			expectedErr: fmt.Errorf("NOT statement do not have expression: not "),
+			message:     "not without expression",
+		},
+		{
+			data:        `{"type":"NOT","rExpr":{"type":"AND"}}`,
+			expectedErr: fmt.Errorf("AND statement do not have right or left expression:  and "),
+			message:     "invalid sub expression",
+		},
+		{
+			data:        `{"type":"ATLEAST","count":1}`,
+			expectedErr: fmt.Errorf("ATLEAST statement do not have expressions: atleast(1)"),
+			message:     "atleast without expressions",
+		},
+		{
+			data:        `{"type":"ATLEAST","exprs":[{"type":"TRUE"}],"count":2}`,
+			expectedErr: fmt.Errorf("ATLEAST count must be between 1 and the number of expressions (1): atleast(2, true)"),
+			message:     "atleast with invalid count",
+		},
+		{
+			data:        `{"type":"COUNT","tag":{"name":"tag1"},"count":1}`,
+			expectedErr: fmt.Errorf("COUNT statement do not have a valid operator: count(\"tag1\") UNSET 1"),
+			message:     "count without operator",
+		},
+		{
+			data:        `{"type":"COUNT","tag":{"name":"tag1"},"operator":"=>"}`,
+			expectedErr: fmt.Errorf("unexpected compare operator \"=>\""),
+			message:     "count with unknown operator",
+		},
+		{
+			data:        `{"type":"COUNT","operator":"<","count":1}`,
+			expectedErr: fmt.Errorf("COUNT statement do not have tag: count(\"\") < 1"),
+			message:     "count without tag",
+		},
+		{
+			data:        `{"type":"SAMEPARENT","exprs":[{"type":"UNIT","tag":{"name":"tag1"}}]}`,
+			expectedErr: fmt.Errorf("SAMEPARENT statement needs at least 2 tags: samefield(\"tag1\")"),
+			message:     "sameparent with one tag",
+		},
+		{
+			data:        `{"type":"SAMEPARENT","exprs":[{"type":"UNIT","tag":{"name":"tag1"}},{"type":"TRUE"}],"depth":1}`,
+			expectedErr: fmt.Errorf("SAMEPARENT statement can only have tags: sameparent(\"tag1\", true, 1)"),
+			message:     "sameparent with constant",
+		},
+		{
+			data:        `{"type":"SAMEPARENT","exprs":[{"type":"UNIT","tag":{"name":"tag1"}},{"type":"UNIT","tag":{"name":"tag2"}}],"depth":-1}`,
+			expectedErr: fmt.Errorf("SAMEPARENT statement can not have a negative depth: sameparent(\"tag1\", \"tag2\", -1)"),
+			message:     "sameparent with negative depth",
+		},
+		{
+			data:        `{"type":"RULE"}`,
+			expectedErr: fmt.Errorf("RULE statement do not have rule name: rule(\"\")"),
+			message:     "rule without name",
+		},
+	}
+
+	for _, tc := range tests {
+		var exp Expression
+		err := json.Unmarshal([]byte(tc.data), &exp)
+		assert.Equal(tc.expectedErr, err, tc.message+" json")
+
+		var yamlExp Expression
+		err = yaml.Unmarshal([]byte(tc.data), &yamlExp)
+		assert.Equal(tc.expectedErr, err, tc.message+" yaml")
+	}
+}
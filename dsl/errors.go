@@ -0,0 +1,76 @@
+package dsl
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Position is the position of a rune on the expression.
+// Offset is the number of runes before it, Line and Column start at 1.
+type Position struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+// String returns the position as "line:column".
+func (pos Position) String() string {
+	return fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+}
+
+// ParseError is the error returned by the Scanner and the Parser when
+// the expression is invalid.
+type ParseError struct {
+	// Pos is the position of the token that caused the error.
+	Pos Position
+	// Token is the token found at Pos, it is ILLEGAL if the token could not be scanned.
+	Token Token
+	// Lit is the literal found at Pos.
+	Lit string
+	// Expected are the tokens that would be valid at Pos, it is empty
+	// if the token could not be scanned.
+	Expected []Token
+	// Msg is the description of the error.
+	Msg string
+}
+
+// Error returns the message and the position of the error.
+func (pe *ParseError) Error() string {
+	return fmt.Sprintf("%s (line %d, column %d)", pe.Msg, pe.Pos.Line, pe.Pos.Column)
+}
+
+// Snippet returns the line of the source where the error was found followed
+// by a line with a caret under the column of the error. Eg:
+//
+//	"tag1" and ( "tag2"
+//	                   ^
+//
+// An empty string is returned if the position is not on the source.
+func (pe *ParseError) Snippet(source string) string {
+	lines := strings.Split(source, "\n")
+	if pe.Pos.Line < 1 || pe.Pos.Line > len(lines) || pe.Pos.Column < 1 {
+		return ""
+	}
+
+	line := lines[pe.Pos.Line-1]
+	var caret strings.Builder
+	col := 1
+	for _, ch := range line {
+		if col == pe.Pos.Column {
+			break
+		}
+		// keeps the tabs so the caret is aligned when the line is printed
+		if ch == '\t' {
+			caret.WriteRune('\t')
+		} else {
+			caret.WriteRune(' ')
+		}
+		col++
+	}
+	for ; col < pe.Pos.Column; col++ {
+		caret.WriteRune(' ')
+	}
+	caret.WriteRune('^')
+
+	return line + "\n" + caret.String()
+}
@@ -0,0 +1,51 @@
+package dsl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseError(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		source          string
+		pos             Position
+		expectedSnippet string
+		message         string
+	}{
+		{
+			source:          `"tag1" and ( "tag2"`,
+			pos:             Position{Offset: 19, Line: 1, Column: 20},
+			expectedSnippet: "\"tag1\" and ( \"tag2\"\n                   ^",
+			message:         "end of the source",
+		},
+		{
+			source:          "\"tag1\" and\n\t(\"tag2\" or)",
+			pos:             Position{Offset: 21, Line: 2, Column: 11},
+			expectedSnippet: "\t(\"tag2\" or)\n\t         ^",
+			message:         "second line with tab",
+		},
+		{
+			source:          `"tag1"`,
+			pos:             Position{Offset: 0, Line: 1, Column: 1},
+			expectedSnippet: "\"tag1\"\n^",
+			message:         "first column",
+		},
+		{
+			source:          `"tag1"`,
+			pos:             Position{Offset: 10, Line: 2, Column: 1},
+			expectedSnippet: "",
+			message:         "position out of the source",
+		},
+	}
+
+	for _, tc := range tests {
+		pe := &ParseError{Pos: tc.pos, Msg: "some error"}
+		assert.Equal(tc.expectedSnippet, pe.Snippet(tc.source), tc.message)
+	}
+
+	pe := &ParseError{Pos: Position{Offset: 21, Line: 2, Column: 11}, Msg: "invalid expression: incomplete expression OR"}
+	assert.Equal("invalid expression: incomplete expression OR (line 2, column 11)", pe.Error(), "error message")
+	assert.Equal("2:11", pe.Pos.String(), "position string")
+}
@@ -0,0 +1,199 @@
+package dsl
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Explanation is the value of an expression node and the explanations of its children.
+// It has the same structure of the explained expression.
+type Explanation struct {
+	Expression *Expression
+	Value      bool
+	// MatchedFieldPaths are the field paths where the tag of an UNIT or COUNT
+	// expression was found that matched its field path (see FieldPathMatching).
+	// It is empty for the other types.
+	MatchedFieldPaths []string
+	LExpl             *Explanation
+	RExpl             *Explanation
+	// Expls are the explanations of the operands of ATLEAST and SAMEPARENT.
+	// The matched field paths of the tags of SAMEPARENT are only the ones
+	// that share the ancestor with the other tags.
+	Expls []*Explanation
+}
+
+// Explain solves the expression like Solve, but it returns the value of every node of the
+// expression, so it is possible to know which branches made the expression true or false.
+// All nodes are evaluated, even the ones that do not change the final value.
+func (exp *Expression) Explain(fieldPathByTag map[string][]string) (*Explanation, error) {
+	return exp.explain(fieldPathByTag, exp.withFieldPaths(SolveOptions{}))
+}
+
+// ExplainWithMatching is the same as Explain but the plain field paths of the tags
+// are matched using the given FieldPathMatching.
+func (exp *Expression) ExplainWithMatching(
+	fieldPathByTag map[string][]string,
+	matching FieldPathMatching,
+) (*Explanation, error) {
+	return exp.explain(fieldPathByTag, exp.withFieldPaths(SolveOptions{Matching: matching}))
+}
+
+// ExplainWithOptions is the same as Explain but it uses the given options.
+func (exp *Expression) ExplainWithOptions(
+	fieldPathByTag map[string][]string,
+	opts SolveOptions,
+) (*Explanation, error) {
+	return exp.explain(fieldPathByTag, exp.withFieldPaths(opts))
+}
+
+// explain implements Explain
+func (exp *Expression) explain(fieldPathByTag map[string][]string, opts SolveOptions) (*Explanation, error) {
+	expl := &Explanation{Expression: exp}
+	switch exp.Type {
+	case UNIT_EXPR:
+		fieldPaths, ok := fieldPathByTag[exp.Tag.Name]
+		if !ok {
+			return expl, nil
+		}
+		for _, fieldPath := range fieldPaths {
+			if opts.matchFieldPath(exp.Tag.FieldPath, fieldPath) {
+				expl.MatchedFieldPaths = append(expl.MatchedFieldPaths, fieldPath)
+			}
+		}
+		expl.Value = exp.Tag.FieldPath == "" || len(expl.MatchedFieldPaths) > 0
+		return expl, nil
+
+	case AND_EXPR, OR_EXPR:
+		if exp.LExpr == nil || exp.RExpr == nil {
+			return nil, fmt.Errorf("%s statement do not have right or left expression: %v", exp.GetTypeName(), exp)
+		}
+		var err error
+		expl.LExpl, err = exp.LExpr.explain(fieldPathByTag, opts)
+		if err != nil {
+			return nil, err
+		}
+		expl.RExpl, err = exp.RExpr.explain(fieldPathByTag, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		if exp.Type == AND_EXPR {
+			expl.Value = expl.LExpl.Value && expl.RExpl.Value
+		} else {
+			expl.Value = expl.LExpl.Value || expl.RExpl.Value
+		}
+		return expl, nil
+
+	case NOT_EXPR:
+		if exp.RExpr == nil {
+			return nil, fmt.Errorf("NOT statement do not have expression: %v", exp)
+		}
+		var err error
+		expl.RExpl, err = exp.RExpr.explain(fieldPathByTag, opts)
+		if err != nil {
+			return nil, err
+		}
+		expl.Value = !expl.RExpl.Value
+		return expl, nil
+
+	case TRUE_EXPR, FALSE_EXPR:
+		expl.Value = exp.Type == TRUE_EXPR
+		return expl, nil
+
+	case ATLEAST_EXPR:
+		if len(exp.Exprs) == 0 {
+			return nil, fmt.Errorf("ATLEAST statement do not have expressions: %v", exp)
+		}
+		trueCount := 0
+		for _, operand := range exp.Exprs {
+			operandExpl, err := operand.explain(fieldPathByTag, opts)
+			if err != nil {
+				return nil, err
+			}
+			if operandExpl.Value {
+				trueCount++
+			}
+			expl.Expls = append(expl.Expls, operandExpl)
+		}
+		expl.Value = trueCount >= exp.Count
+		return expl, nil
+
+	case COUNT_EXPR:
+		expl.MatchedFieldPaths = matchedFieldPaths(exp.Tag, fieldPathByTag[exp.Tag.Name], opts)
+		expl.Value = exp.Operator.Compare(exp.countFieldPaths(fieldPathByTag, opts), exp.Count)
+		return expl, nil
+
+	case SAMEPARENT_EXPR:
+		if len(exp.Exprs) < 2 {
+			return nil, fmt.Errorf("SAMEPARENT statement needs at least 2 tags: %v", exp)
+		}
+		shared, matchedByOperand := exp.sharedAncestors(fieldPathByTag, opts)
+		expl.Value = len(shared) > 0
+		for i, operand := range exp.Exprs {
+			operandExpl := &Explanation{Expression: operand}
+			if expl.Value {
+				operandExpl.MatchedFieldPaths = colocatedFieldPaths(matchedByOperand[i], shared, exp.Depth)
+				operandExpl.Value = true
+			}
+			expl.Expls = append(expl.Expls, operandExpl)
+		}
+		return expl, nil
+
+	case RULE_EXPR:
+		expl.Value = opts.FiredRules[exp.RuleName]
+		return expl, nil
+
+	default:
+		return nil, fmt.Errorf("unable to process expression type %d", exp.Type)
+	}
+}
+
+// PrettyFormat returns the explanation formated on a tabbed structure
+// with the value of each node and the matched field paths.
+// Eg: for the expression "tag1:field1" or "tag2"
+//
+//	OR: true
+//	    tag1[field1]: true (field1.a, field1.b)
+//	    tag2: false
+func (expl *Explanation) PrettyFormat() string {
+	return expl.prettyFormat(0)
+}
+
+// prettyFormat implementation of PrettyFormat()
+func (expl *Explanation) prettyFormat(lvl int) (pprint string) {
+	tabs := "    "
+	onLVL := strings.Repeat(tabs, lvl)
+	exp := expl.Expression
+	matched := ""
+	if len(expl.MatchedFieldPaths) > 0 {
+		matched = fmt.Sprintf(" (%s)", strings.Join(expl.MatchedFieldPaths, ", "))
+	}
+	switch exp.Type {
+	case UNIT_EXPR:
+		return fmt.Sprintf("%s%s: %t%s\n", onLVL, prettyTagInfo(exp.Tag), expl.Value, matched)
+	case COUNT_EXPR:
+		return fmt.Sprintf("%sCOUNT %s %s %d: %t%s\n",
+			onLVL, prettyTagInfo(exp.Tag), exp.Operator.GetName(), exp.Count, expl.Value, matched)
+	case ATLEAST_EXPR:
+		pprint = fmt.Sprintf("%sATLEAST %d: %t\n", onLVL, exp.Count, expl.Value)
+	case SAMEPARENT_EXPR:
+		pprint = fmt.Sprintf("%sSAMEPARENT %d: %t\n", onLVL, exp.Depth, expl.Value)
+	case RULE_EXPR:
+		return fmt.Sprintf("%sRULE %s: %t\n", onLVL, exp.RuleName, expl.Value)
+	default:
+		pprint = fmt.Sprintf("%s%s: %t\n", onLVL, exp.GetTypeName(), expl.Value)
+	}
+	if expl.LExpl != nil {
+		pprint += expl.LExpl.prettyFormat(lvl + 1)
+	}
+
+	if expl.RExpl != nil {
+		pprint += expl.RExpl.prettyFormat(lvl + 1)
+	}
+
+	for _, operandExpl := range expl.Expls {
+		pprint += operandExpl.prettyFormat(lvl + 1)
+	}
+
+	return
+}
@@ -0,0 +1,127 @@
+package dsl
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplainSameAsSolve(t *testing.T) {
+	assert := assert.New(t)
+	for _, tc := range solverTestCases {
+		exp, err := NewParser(strings.NewReader(tc.expStr)).Parse()
+		assert.Nil(err, tc.message)
+		expl, err := exp.Explain(tc.fieldPathByTag)
+		assert.Nil(err, tc.message)
+		assert.Equal(tc.expectedResp, expl.Value, tc.message)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	assert := assert.New(t)
+	exp, err := NewParser(strings.NewReader(`"tag3:Field3" or not ("tag4" and "tag5")`)).Parse()
+	assert.Nil(err)
+
+	expl, err := exp.Explain(map[string][]string{
+		"tag3": {"Field3.a", "Field4", "Field3.b"},
+		"tag4": {"Field1"},
+	})
+	assert.Nil(err)
+	assert.Equal(&Explanation{
+		Expression: exp,
+		Value:      true,
+		LExpl: &Explanation{
+			Expression:        exp.LExpr,
+			Value:             true,
+			MatchedFieldPaths: []string{"Field3.a", "Field3.b"},
+		},
+		RExpl: &Explanation{
+			Expression: exp.RExpr,
+			Value:      true,
+			RExpl: &Explanation{
+				Expression: exp.RExpr.RExpr,
+				Value:      false,
+				LExpl: &Explanation{
+					Expression:        exp.RExpr.RExpr.LExpr,
+					Value:             true,
+					MatchedFieldPaths: []string{"Field1"},
+				},
+				RExpl: &Explanation{
+					Expression: exp.RExpr.RExpr.RExpr,
+					Value:      false,
+				},
+			},
+		},
+	}, expl, "explanation")
+
+	assert.Equal(`OR: true
+    tag3[Field3]: true (Field3.a, Field3.b)
+    NOT: true
+        AND: false
+            tag4: true (Field1)
+            tag5: false
+`, expl.PrettyFormat(), "pretty format")
+}
+
+func TestExplainQuantifiers(t *testing.T) {
+	assert := assert.New(t)
+	exp, err := NewParser(strings.NewReader(`atleast(2, "tag1", "tag2", count("tag3:user") >= 2)`)).Parse()
+	assert.Nil(err)
+
+	expl, err := exp.Explain(map[string][]string{
+		"tag1": {"Field1"},
+		"tag3": {"user.name", "user.email", "username"},
+	})
+	assert.Nil(err)
+	assert.True(expl.Value, "value")
+	assert.Equal([]string{"user.name", "user.email"}, expl.Expls[2].MatchedFieldPaths, "count matched field paths")
+	assert.Equal(`ATLEAST 2: true
+    tag1: true (Field1)
+    tag2: false
+    COUNT tag3[user] >= 2: true (user.name, user.email)
+`, expl.PrettyFormat(), "pretty format")
+	assert.Equal(`ATLEAST 2
+    tag1
+    tag2
+    COUNT tag3[user] >= 2
+`, exp.PrettyFormat(), "expression pretty format")
+}
+
+func TestExplainErrors(t *testing.T) {
+	assert := assert.New(t)
+	tag := &Expression{Type: UNIT_EXPR, Tag: TagInfo{Name: "tag1"}}
+	tests := []struct {
+		exp         *Expression
+		expectedErr error
+		message     string
+	}{
+		{
+			exp:         &Expression{Type: AND_EXPR, LExpr: tag},
+			expectedErr: fmt.Errorf("AND statement do not have right or left expression: \"tag1\" and "),
+			message:     "and without right expression",
+		},
+		{
+			exp:         &Expression{Type: OR_EXPR, RExpr: tag},
+			expectedErr: fmt.Errorf("OR statement do not have right or left expression:  or \"tag1\""),
+			message:     "or without left expression",
+		},
+		{
+			exp:         &Expression{Type: NOT_EXPR},
+			expectedErr: fmt.Errorf("NOT statement do not have expression: not "),
+			message:     "not without expression",
+		},
+		{
+			exp:         &Expression{Type: OR_EXPR, LExpr: tag, RExpr: &Expression{}},
+			expectedErr: fmt.Errorf("unable to process expression type 0"),
+			message:     "unset expression",
+		},
+	}
+
+	for _, tc := range tests {
+		expl, err := tc.exp.Explain(nil)
+		assert.Equal(tc.expectedErr, err, tc.message)
+		assert.Nil(expl, tc.message)
+	}
+}
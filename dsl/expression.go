@@ -2,6 +2,7 @@ package dsl
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -14,6 +15,12 @@ const (
 	OR_EXPR
 	NOT_EXPR
 	UNIT_EXPR
+	TRUE_EXPR
+	FALSE_EXPR
+	ATLEAST_EXPR
+	COUNT_EXPR
+	SAMEPARENT_EXPR
+	RULE_EXPR
 )
 
 // GetName returns a readable name for the ExprType value
@@ -29,24 +36,53 @@ func (exprType ExprType) GetName() string {
 		return "NOT"
 	case UNIT_EXPR:
 		return "UNIT"
+	case TRUE_EXPR:
+		return "TRUE"
+	case FALSE_EXPR:
+		return "FALSE"
+	case ATLEAST_EXPR:
+		return "ATLEAST"
+	case COUNT_EXPR:
+		return "COUNT"
+	case SAMEPARENT_EXPR:
+		return "SAMEPARENT"
+	case RULE_EXPR:
+		return "RULE"
 	default:
 		return "UNEXPECTED"
 	}
 }
 
-// TagInfo holds the name of the tag and the field path prefix that it need to be found at.
+// TagInfo holds the name of the tag and the field path that it need to be found at.
+// The field path can be a plain path, a glob or a regex, see MatchFieldPath.
 type TagInfo struct {
-	Name      string
-	FieldPath string
+	Name      string `json:"name" yaml:"name"`
+	FieldPath string `json:"fieldPath,omitempty" yaml:"fieldPath,omitempty"`
 }
 
-// Expression can be a TagInfo (UNIT) or a function composed by
-// one or two other expressions (NOT, AND, OR).
+// Expression can be a TagInfo (UNIT), a constant (TRUE, FALSE), a
+// function composed by one or two other expressions (NOT, AND, OR),
+// a quantifier of a list of expressions (ATLEAST), the comparison of
+// the number of field paths where a tag was found (COUNT), the
+// co-location of tags on the same field or object (SAMEPARENT) or
+// a reference to the result of another rule (RULE).
 type Expression struct {
 	LExpr *Expression
 	RExpr *Expression
 	Type  ExprType
 	Tag   TagInfo
+	// Exprs are the operands of ATLEAST or the UNIT operands of SAMEPARENT
+	Exprs []*Expression
+	// Count is the minimum number of true operands of ATLEAST or
+	// the number compared with the number of field paths of COUNT
+	Count int
+	// Operator is the comparison of COUNT
+	Operator CompareOp
+	// Depth is the maximum number of segments between the field paths of the
+	// tags of SAMEPARENT and their shared ancestor, 0 means the same field
+	Depth int
+	// RuleName is the name of the rule referenced by RULE
+	RuleName string
 }
 
 // GetTypeName returns the type of the expression with a readable name
@@ -54,18 +90,161 @@ func (exp *Expression) GetTypeName() string {
 	return exp.Type.GetName()
 }
 
+// GetTags returns the list of unique tags that are used on the expression
+// in the order that they are found.
+func (exp *Expression) GetTags() (tags []string) {
+	seen := make(map[string]struct{})
+	exp.walkTags(func(tag TagInfo) {
+		if _, ok := seen[tag.Name]; !ok {
+			seen[tag.Name] = struct{}{}
+			tags = append(tags, tag.Name)
+		}
+	})
+	return
+}
+
+// GetFields returns the list of unique field paths that are used on the expression
+// in the order that they are found.
+func (exp *Expression) GetFields() (fields []string) {
+	seen := make(map[string]struct{})
+	exp.walkTags(func(tag TagInfo) {
+		if tag.FieldPath == "" {
+			return
+		}
+		if _, ok := seen[tag.FieldPath]; !ok {
+			seen[tag.FieldPath] = struct{}{}
+			fields = append(fields, tag.FieldPath)
+		}
+	})
+	return
+}
+
+// GetRules returns the list of unique rule names that are referenced on the
+// expression in the order that they are found.
+func (exp *Expression) GetRules() (rules []string) {
+	seen := make(map[string]struct{})
+	exp.walk(func(node *Expression) {
+		if node.Type != RULE_EXPR {
+			return
+		}
+		if _, ok := seen[node.RuleName]; !ok {
+			seen[node.RuleName] = struct{}{}
+			rules = append(rules, node.RuleName)
+		}
+	})
+	return
+}
+
+// walkTags calls fn with the TagInfo of all UNIT and COUNT expressions from left to right.
+func (exp *Expression) walkTags(fn func(tag TagInfo)) {
+	exp.walk(func(node *Expression) {
+		if node.Type == UNIT_EXPR || node.Type == COUNT_EXPR {
+			fn(node.Tag)
+		}
+	})
+}
+
+// walk calls fn with all the nodes of the expression from left to right,
+// the parents are visited before their children.
+func (exp *Expression) walk(fn func(node *Expression)) {
+	if exp == nil {
+		return
+	}
+	fn(exp)
+	exp.LExpr.walk(fn)
+	exp.RExpr.walk(fn)
+	for _, operand := range exp.Exprs {
+		operand.walk(fn)
+	}
+}
+
 // Solve solves the expresion using the ginven values of fieldPathByTag.
 // fieldPathByTag will hold the values of all tags that were found with a
-// list of field paths that the tag was found
+// list of field paths that the tag was found.
+// The right side of AND and OR is solved only when the left side does not define
+// the result, so the sub expressions that are skipped are not validated (see Validate).
+// The field paths of the tags are matched using MatchFieldPath and the rule
+// references are false, see SolveWithOptions.
 func (exp *Expression) Solve(
 	fieldPathByTag map[string][]string,
 ) (bool, error) {
-	eval, err := exp.solve(fieldPathByTag)
+	eval, err := exp.solve(fieldPathByTag, exp.withFieldPaths(SolveOptions{}))
 	return eval, err
 }
 
+// SolveOptions are the settings used to solve an expression.
+type SolveOptions struct {
+	// Matching is how the plain field paths of the tags are matched
+	Matching FieldPathMatching
+	// FieldPaths are the compiled glob and regex field paths of the tags (see CompileFieldPaths).
+	// If it is nil the field paths of the expression are compiled on each solve.
+	FieldPaths FieldPathMatchers
+	// FiredRules are the rules that were evaluated as true, used to solve the
+	// rule references (eg: rule("name")). The rules that are not on the map
+	// are considered false.
+	FiredRules map[string]bool
+}
+
+// SolveWithMatching is the same as Solve but the plain field paths of the tags
+// are matched using the given FieldPathMatching.
+func (exp *Expression) SolveWithMatching(
+	fieldPathByTag map[string][]string,
+	matching FieldPathMatching,
+) (bool, error) {
+	return exp.solve(fieldPathByTag, exp.withFieldPaths(SolveOptions{Matching: matching}))
+}
+
+// SolveWithOptions is the same as Solve but it uses the given options.
+func (exp *Expression) SolveWithOptions(
+	fieldPathByTag map[string][]string,
+	opts SolveOptions,
+) (bool, error) {
+	return exp.solve(fieldPathByTag, exp.withFieldPaths(opts))
+}
+
+// withFieldPaths returns the options with the field paths of the expression compiled
+// if the options do not have compiled field paths.
+func (exp *Expression) withFieldPaths(opts SolveOptions) SolveOptions {
+	if opts.FieldPaths == nil {
+		opts.FieldPaths = CompileFieldPaths(exp.GetFields())
+	}
+	return opts
+}
+
+// matchFieldPath returns true if the field path where a tag was found matches the
+// field path of the tag, using the compiled field paths of the options.
+func (opts SolveOptions) matchFieldPath(pattern string, fieldPath string) bool {
+	return opts.FieldPaths.Match(opts.Matching, pattern, fieldPath)
+}
+
+// Validate returns an error if the expression or any of its sub expressions is missing
+// the values needed by its type. The expressions returned by the Parser or decoded from
+// JSON and YAML are already valid, but expressions built by hand should be validated
+// before calling Solve.
+func (exp *Expression) Validate() error {
+	if err := exp.validateNode(); err != nil {
+		return err
+	}
+	if exp.LExpr != nil {
+		if err := exp.LExpr.Validate(); err != nil {
+			return err
+		}
+	}
+	if exp.RExpr != nil {
+		if err := exp.RExpr.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, operand := range exp.Exprs {
+		if err := operand.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 //solve implements Solve
-func (exp *Expression) solve(fieldPathByTag map[string][]string) (bool, error) {
+func (exp *Expression) solve(fieldPathByTag map[string][]string, opts SolveOptions) (bool, error) {
 	switch exp.Type {
 	case UNIT_EXPR:
 		if fieldPaths, ok := fieldPathByTag[exp.Tag.Name]; ok {
@@ -74,7 +253,7 @@ func (exp *Expression) solve(fieldPathByTag map[string][]string) (bool, error) {
 			}
 
 			for _, fieldPath := range fieldPaths {
-				if strings.HasPrefix(fieldPath, exp.Tag.FieldPath) {
+				if opts.matchFieldPath(exp.Tag.FieldPath, fieldPath) {
 					return true, nil
 				}
 			}
@@ -86,44 +265,170 @@ func (exp *Expression) solve(fieldPathByTag map[string][]string) (bool, error) {
 		if exp.LExpr == nil || exp.RExpr == nil {
 			return false, fmt.Errorf("AND statement do not have right or left expression: %v", exp)
 		}
-		lval, err := exp.LExpr.solve(fieldPathByTag)
+		lval, err := exp.LExpr.solve(fieldPathByTag, opts)
 		if err != nil {
 			return false, err
 		}
-		rval, err := exp.RExpr.solve(fieldPathByTag)
-		if err != nil {
-			return false, err
+		if !lval {
+			return false, nil
 		}
 
-		return lval && rval, nil
+		return exp.RExpr.solve(fieldPathByTag, opts)
 	case OR_EXPR:
 		if exp.LExpr == nil || exp.RExpr == nil {
 			return false, fmt.Errorf("OR statement do not have right or left expression: %v", exp)
 		}
-		lval, err := exp.LExpr.solve(fieldPathByTag)
+		lval, err := exp.LExpr.solve(fieldPathByTag, opts)
 		if err != nil {
 			return false, err
 		}
-		rval, err := exp.RExpr.solve(fieldPathByTag)
-		if err != nil {
-			return false, err
+		if lval {
+			return true, nil
 		}
 
-		return lval || rval, nil
+		return exp.RExpr.solve(fieldPathByTag, opts)
 	case NOT_EXPR:
 		if exp.RExpr == nil {
 			return false, fmt.Errorf("NOT statement do not have expression: %v", exp)
 		}
-		rval, err := exp.RExpr.solve(fieldPathByTag)
+		rval, err := exp.RExpr.solve(fieldPathByTag, opts)
 		if err != nil {
 			return false, err
 		}
 		return !rval, nil
+	case TRUE_EXPR:
+		return true, nil
+	case FALSE_EXPR:
+		return false, nil
+	case ATLEAST_EXPR:
+		if len(exp.Exprs) == 0 {
+			return false, fmt.Errorf("ATLEAST statement do not have expressions: %v", exp)
+		}
+		return exp.solveAtLeast(fieldPathByTag, opts)
+	case COUNT_EXPR:
+		return exp.Operator.Compare(exp.countFieldPaths(fieldPathByTag, opts), exp.Count), nil
+	case SAMEPARENT_EXPR:
+		if len(exp.Exprs) < 2 {
+			return false, fmt.Errorf("SAMEPARENT statement needs at least 2 tags: %v", exp)
+		}
+		shared, _ := exp.sharedAncestors(fieldPathByTag, opts)
+		return len(shared) > 0, nil
+	case RULE_EXPR:
+		return opts.FiredRules[exp.RuleName], nil
 	default:
 		return false, fmt.Errorf("unable to process expression type %d", exp.Type)
 	}
 }
 
+// String returns the expression as a rule of the DSL. See Format.
+func (exp *Expression) String() string {
+	return exp.Format()
+}
+
+// Format returns the expression as a rule of the DSL using the minimal
+// number of parentheses and escaping the '"', ':' and '\' of the tags
+// and the '"' and '\' of the field paths. Parsing the returned rule gives
+// an expression equal to the formatted one, as long as the tags and field
+// paths do not start or end with spaces, which are trimmed by the Scanner.
+// Eg: for the expression OR(AND(a, b), NOT(OR(c, d[path])))
+//    "a" and "b" or not ("c" or "d:path")
+func (exp *Expression) Format() string {
+	var sb strings.Builder
+	exp.format(&sb, 0)
+	return sb.String()
+}
+
+// format implementation of Format(). The expression is enclosed by
+// parentheses if its precedence is lower than minPrec.
+func (exp *Expression) format(sb *strings.Builder, minPrec int) {
+	if exp == nil {
+		return
+	}
+
+	prec := exp.precedence()
+	if prec < minPrec {
+		sb.WriteString("(")
+		defer sb.WriteString(")")
+	}
+
+	switch exp.Type {
+	case UNIT_EXPR:
+		sb.WriteString(formatTagInfo(exp.Tag))
+	case TRUE_EXPR, FALSE_EXPR:
+		sb.WriteString(strings.ToLower(exp.GetTypeName()))
+	case ATLEAST_EXPR:
+		sb.WriteString("atleast(" + strconv.Itoa(exp.Count))
+		for _, operand := range exp.Exprs {
+			sb.WriteString(", ")
+			operand.format(sb, 0)
+		}
+		sb.WriteString(")")
+	case COUNT_EXPR:
+		sb.WriteString("count(" + formatTagInfo(exp.Tag) + ") ")
+		sb.WriteString(exp.Operator.GetName() + " " + strconv.Itoa(exp.Count))
+	case SAMEPARENT_EXPR:
+		if exp.Depth == 0 {
+			sb.WriteString("samefield(")
+		} else {
+			sb.WriteString("sameparent(")
+		}
+		for i, operand := range exp.Exprs {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			operand.format(sb, 0)
+		}
+		if exp.Depth != 0 {
+			sb.WriteString(", " + strconv.Itoa(exp.Depth))
+		}
+		sb.WriteString(")")
+	case RULE_EXPR:
+		sb.WriteString(`rule("` + tagNameEscaper.Replace(exp.RuleName) + `")`)
+	case NOT_EXPR:
+		sb.WriteString("not ")
+		exp.RExpr.format(sb, prec)
+	case AND_EXPR, OR_EXPR:
+		exp.LExpr.format(sb, prec)
+		sb.WriteString(" " + strings.ToLower(exp.GetTypeName()) + " ")
+		// operators are left associative so the right expression
+		// needs parentheses if it has the same precedence
+		exp.RExpr.format(sb, prec+1)
+	}
+}
+
+// precedence returns the precedence of the expression, the higher
+// the value the tighter it binds.
+func (exp *Expression) precedence() int {
+	switch exp.Type {
+	case OR_EXPR:
+		return 1
+	case AND_EXPR:
+		return 2
+	case NOT_EXPR:
+		return 3
+	default:
+		return 4
+	}
+}
+
+var (
+	// tagNameEscaper escapes the characters of the tag names that are escaped on the DSL
+	tagNameEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `:`, `\:`)
+	// fieldPathEscaper escapes the characters of the field paths that are escaped on the DSL
+	fieldPathEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+)
+
+// formatTagInfo returns the tag info as a quoted TAG of the DSL with
+// the escaped tag name and field path.
+func formatTagInfo(tag TagInfo) string {
+	name := tagNameEscaper.Replace(tag.Name)
+	if tag.FieldPath == "" {
+		return `"` + name + `"`
+	}
+	fieldPath := fieldPathEscaper.Replace(tag.FieldPath)
+	return `"` + name + ":" + fieldPath + `"`
+}
+
 // PrettyFormat returns the expression formated on a tabbed structure
 // Eg: for the expression ("a" and "b") or "c"
 //    OR
@@ -139,14 +444,20 @@ func (exp *Expression) PrettyFormat() string {
 func (exp *Expression) prettyFormat(lvl int) (pprint string) {
 	tabs := "    "
 	onLVL := strings.Repeat(tabs, lvl)
-	if exp.Type == UNIT_EXPR {
-		fieldPath := ""
-		if exp.Tag.FieldPath != "" {
-			fieldPath = fmt.Sprintf("[%s]", exp.Tag.FieldPath)
-		}
-		return fmt.Sprintf("%s%s%s\n", onLVL, exp.Tag.Name, fieldPath)
+	switch exp.Type {
+	case UNIT_EXPR:
+		return fmt.Sprintf("%s%s\n", onLVL, prettyTagInfo(exp.Tag))
+	case COUNT_EXPR:
+		return fmt.Sprintf("%sCOUNT %s %s %d\n", onLVL, prettyTagInfo(exp.Tag), exp.Operator.GetName(), exp.Count)
+	case ATLEAST_EXPR:
+		pprint = fmt.Sprintf("%sATLEAST %d\n", onLVL, exp.Count)
+	case SAMEPARENT_EXPR:
+		pprint = fmt.Sprintf("%sSAMEPARENT %d\n", onLVL, exp.Depth)
+	case RULE_EXPR:
+		return fmt.Sprintf("%sRULE %s\n", onLVL, exp.RuleName)
+	default:
+		pprint = fmt.Sprintf("%s%s\n", onLVL, exp.GetTypeName())
 	}
-	pprint = fmt.Sprintf("%s%s\n", onLVL, exp.GetTypeName())
 	if exp.LExpr != nil {
 		pprint += exp.LExpr.prettyFormat(lvl + 1)
 	}
@@ -155,5 +466,17 @@ func (exp *Expression) prettyFormat(lvl int) (pprint string) {
 		pprint += exp.RExpr.prettyFormat(lvl + 1)
 	}
 
+	for _, operand := range exp.Exprs {
+		pprint += operand.prettyFormat(lvl + 1)
+	}
+
 	return
 }
+
+// prettyTagInfo returns the tag name followed by the field path between brackets
+func prettyTagInfo(tag TagInfo) string {
+	if tag.FieldPath == "" {
+		return tag.Name
+	}
+	return fmt.Sprintf("%s[%s]", tag.Name, tag.FieldPath)
+}
@@ -1,6 +1,7 @@
 package dsl
 
 import (
+	"fmt"
 	"strings"
 	"testing"
 
@@ -18,6 +19,190 @@ func TestSolver(t *testing.T) {
 	}
 }
 
+func TestFormat(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		expStr         string
+		expectedFormat string
+		message        string
+	}{
+		{
+			expStr:         `"tag1"`,
+			expectedFormat: `"tag1"`,
+			message:        "single tag",
+		},
+		{
+			expStr:         `  ( ("tag1:field1.index(0)") )`,
+			expectedFormat: `"tag1:field1.index(0)"`,
+			message:        "redundant parentheses",
+		},
+		{
+			expStr:         `("tag1" and "tag2") or ("tag3" and not "tag4")`,
+			expectedFormat: `"tag1" and "tag2" or "tag3" and not "tag4"`,
+			message:        "and inside or",
+		},
+		{
+			expStr:         `("tag1" or "tag2") and "tag3"`,
+			expectedFormat: `("tag1" or "tag2") and "tag3"`,
+			message:        "or inside and",
+		},
+		{
+			expStr:         `"tag1" and ("tag2" and "tag3")`,
+			expectedFormat: `"tag1" and ("tag2" and "tag3")`,
+			message:        "right associative and",
+		},
+		{
+			expStr:         `("tag1" and "tag2") and "tag3"`,
+			expectedFormat: `"tag1" and "tag2" and "tag3"`,
+			message:        "left associative and",
+		},
+		{
+			expStr:         `NOT ("tag1" OR "tag2") AND NOT NOT "tag3"`,
+			expectedFormat: `not ("tag1" or "tag2") and not not "tag3"`,
+			message:        "not",
+		},
+		{
+			expStr:         `"tag \: \" \\:path\"1\" \\"`,
+			expectedFormat: `"tag \: \" \\:path\"1\" \\"`,
+			message:        "escaped tag and field path",
+		},
+		{
+			expStr:         `"tag:path:with:colons"`,
+			expectedFormat: `"tag:path:with:colons"`,
+			message:        "field path with colons",
+		},
+	}
+
+	for _, tc := range tests {
+		exp, err := NewParser(strings.NewReader(tc.expStr)).Parse()
+		assert.Nil(err, tc.message)
+		assert.Equal(tc.expectedFormat, exp.Format(), tc.message)
+		assert.Equal(tc.expectedFormat, exp.String(), tc.message)
+	}
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+	expressions := []*Expression{
+		{
+			Type: OR_EXPR,
+			LExpr: &Expression{
+				Type:  AND_EXPR,
+				LExpr: &Expression{Type: UNIT_EXPR, Tag: TagInfo{Name: `a"b`}},
+				RExpr: &Expression{
+					Type:  OR_EXPR,
+					LExpr: &Expression{Type: UNIT_EXPR, Tag: TagInfo{Name: `c:d`, FieldPath: `e"f\g`}},
+					RExpr: &Expression{Type: UNIT_EXPR, Tag: TagInfo{Name: `h\i`}},
+				},
+			},
+			RExpr: &Expression{
+				Type: NOT_EXPR,
+				RExpr: &Expression{
+					Type:  OR_EXPR,
+					LExpr: &Expression{Type: UNIT_EXPR, Tag: TagInfo{Name: "j"}},
+					RExpr: &Expression{
+						Type:  OR_EXPR,
+						LExpr: &Expression{Type: UNIT_EXPR, Tag: TagInfo{Name: "k"}},
+						RExpr: &Expression{Type: UNIT_EXPR, Tag: TagInfo{Name: "l"}},
+					},
+				},
+			},
+		},
+	}
+	for _, tc := range solverTestCases {
+		exp, err := NewParser(strings.NewReader(tc.expStr)).Parse()
+		assert.Nil(err, tc.message)
+		expressions = append(expressions, exp)
+	}
+
+	for _, exp := range expressions {
+		formatted := exp.Format()
+		parsed, err := NewParser(strings.NewReader(formatted)).Parse()
+		assert.Nil(err, formatted)
+		assert.Equal(exp, parsed, formatted)
+	}
+}
+
+func TestGetTagsAndFields(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		expStr         string
+		expectedTags   []string
+		expectedFields []string
+		message        string
+	}{
+		{
+			expStr:         `"tag1"`,
+			expectedTags:   []string{"tag1"},
+			expectedFields: nil,
+			message:        "single tag",
+		},
+		{
+			expStr:         `"tag2:field1" and not ("tag1" or "tag2:field2") or "tag1:field1"`,
+			expectedTags:   []string{"tag2", "tag1"},
+			expectedFields: []string{"field1", "field2"},
+			message:        "repeated tags and fields",
+		},
+	}
+
+	for _, tc := range tests {
+		exp, err := NewParser(strings.NewReader(tc.expStr)).Parse()
+		assert.Nil(err, tc.message)
+		assert.Equal(tc.expectedTags, exp.GetTags(), tc.message+" tags")
+		assert.Equal(tc.expectedFields, exp.GetFields(), tc.message+" fields")
+	}
+}
+
+func TestGetRules(t *testing.T) {
+	assert := assert.New(t)
+	exp, err := NewParser(strings.NewReader(`rule("b") and ("tag1" or not rule("a")) or atleast(1, rule("b"), rule("c"))`)).Parse()
+	assert.Nil(err)
+	assert.Equal([]string{"b", "a", "c"}, exp.GetRules())
+	assert.Equal([]string{"tag1"}, exp.GetTags())
+
+	exp, err = NewParser(strings.NewReader(`"tag1"`)).Parse()
+	assert.Nil(err)
+	assert.Nil(exp.GetRules())
+}
+
+func TestSolveRuleReferences(t *testing.T) {
+	assert := assert.New(t)
+	fieldPathByTag := map[string][]string{"tag1": {"field1"}}
+	tests := []struct {
+		expStr     string
+		firedRules map[string]bool
+		expected   bool
+		message    string
+	}{
+		{expStr: `rule("rule1")`, firedRules: map[string]bool{"rule1": true}, expected: true, message: "fired rule"},
+		{expStr: `rule("rule1")`, firedRules: map[string]bool{"rule2": true}, expected: false, message: "not fired rule"},
+		{expStr: `rule("rule1")`, firedRules: nil, expected: false, message: "without fired rules"},
+		{expStr: `rule("rule1") and "tag1:field1"`, firedRules: map[string]bool{"rule1": true}, expected: true, message: "rule and tag"},
+		{expStr: `not rule("rule1") and "tag1"`, firedRules: map[string]bool{"rule1": true}, expected: false, message: "negated rule"},
+		{expStr: `anyof(rule("rule1"), rule("rule2"))`, firedRules: map[string]bool{"rule2": true}, expected: true, message: "quantifier of rules"},
+	}
+
+	for _, tc := range tests {
+		exp, err := NewParser(strings.NewReader(tc.expStr)).Parse()
+		assert.Nil(err, tc.message)
+		opts := SolveOptions{FiredRules: tc.firedRules}
+		res, err := exp.SolveWithOptions(fieldPathByTag, opts)
+		assert.Nil(err, tc.message)
+		assert.Equal(tc.expected, res, tc.message)
+
+		expl, err := exp.ExplainWithOptions(fieldPathByTag, opts)
+		assert.Nil(err, tc.message)
+		assert.Equal(tc.expected, expl.Value, tc.message+" explain")
+	}
+
+	exp, err := NewParser(strings.NewReader(`"tag1" and rule("rule1")`)).Parse()
+	assert.Nil(err)
+	assert.Equal("AND\n    tag1\n    RULE rule1\n", exp.PrettyFormat())
+	expl, err := exp.ExplainWithOptions(fieldPathByTag, SolveOptions{FiredRules: map[string]bool{"rule1": true}})
+	assert.Nil(err)
+	assert.Equal("AND: true\n    tag1: true (field1)\n    RULE rule1: true\n", expl.PrettyFormat())
+}
+
 var solverTestCases = []struct {
 	expStr         string
 	fieldPathByTag map[string][]string
@@ -259,7 +444,343 @@ var solverTestCases = []struct {
 		fieldPathByTag: map[string][]string{
 			"tag1": {"field2"},
 		},
+		expectedResp: false,
+		message:      "single tag with field partial segment false",
+	},
+	{
+		expStr: `"tag1:field1.field2"`,
+		fieldPathByTag: map[string][]string{
+			"tag1": {"field1.field2"},
+		},
+		expectedResp: true,
+		message:      "single tag with field equal field true",
+	},
+	{
+		expStr: `"tag1" and true`,
+		fieldPathByTag: map[string][]string{
+			"tag1": {"field1"},
+		},
 		expectedResp: true,
-		message:      "single tag with field partial field true 2",
+		message:      "and with true constant",
 	},
+	{
+		expStr: `"tag1" or not TRUE or false`,
+		fieldPathByTag: map[string][]string{
+			"tag2": {"field1"},
+		},
+		expectedResp: false,
+		message:      "or with constants",
+	},
+	{
+		expStr: `atleast(2, "tag1", "tag2", "tag3")`,
+		fieldPathByTag: map[string][]string{
+			"tag1": {"field1"},
+			"tag3": {"field1"},
+		},
+		expectedResp: true,
+		message:      "atleast true",
+	},
+	{
+		expStr: `atleast(2, "tag1", "tag2" and "tag3", not "tag4")`,
+		fieldPathByTag: map[string][]string{
+			"tag1": {"field1"},
+			"tag2": {"field1"},
+			"tag4": {"field1"},
+		},
+		expectedResp: false,
+		message:      "atleast with expressions false",
+	},
+	{
+		expStr: `atleast(3, "tag1", "tag2", "tag3") or "tag4"`,
+		fieldPathByTag: map[string][]string{
+			"tag1": {"field1"},
+			"tag2": {"field1"},
+			"tag3": {"field1"},
+		},
+		expectedResp: true,
+		message:      "atleast all true",
+	},
+	{
+		expStr: `anyof("tag1", "tag2:field2")`,
+		fieldPathByTag: map[string][]string{
+			"tag2": {"field2.inner"},
+		},
+		expectedResp: true,
+		message:      "anyof true",
+	},
+	{
+		expStr: `not anyof("tag1", "tag2")`,
+		fieldPathByTag: map[string][]string{
+			"tag3": {"field1"},
+		},
+		expectedResp: true,
+		message:      "not anyof",
+	},
+	{
+		expStr: `count("tag1") >= 3`,
+		fieldPathByTag: map[string][]string{
+			"tag1": {"field1", "field2", "field3"},
+		},
+		expectedResp: true,
+		message:      "count greater or equal true",
+	},
+	{
+		expStr: `count("tag1") >= 3`,
+		fieldPathByTag: map[string][]string{
+			"tag1": {"field1", "field2", "field2"},
+		},
+		expectedResp: false,
+		message:      "count does not include repeated field paths",
+	},
+	{
+		expStr: `count("tag1:user") == 2 and count("tag2") < 1`,
+		fieldPathByTag: map[string][]string{
+			"tag1": {"user.name", "user.email", "username"},
+		},
+		expectedResp: true,
+		message:      "count with field path and missing tag",
+	},
+	{
+		expStr: `count("tag1") != 1 or count("tag1") > 1 or count("tag1") <= 0`,
+		fieldPathByTag: map[string][]string{
+			"tag1": {"field1"},
+		},
+		expectedResp: false,
+		message:      "count comparisons false",
+	},
+	{
+		expStr: `count("tag1") == 1 and count("tag1:field1") == 0`,
+		fieldPathByTag: map[string][]string{
+			"tag1": nil,
+		},
+		expectedResp: true,
+		message:      "count of tag found without field paths",
+	},
+	{
+		expStr: `samefield("tag1", "tag2")`,
+		fieldPathByTag: map[string][]string{
+			"tag1": {"customers.index(0).name", "customers.index(1).name"},
+			"tag2": {"customers.index(1).name"},
+		},
+		expectedResp: true,
+		message:      "samefield true",
+	},
+	{
+		expStr: `samefield("tag1", "tag2")`,
+		fieldPathByTag: map[string][]string{
+			"tag1": {"customers.index(0).name"},
+			"tag2": {"customers.index(0).ssn"},
+		},
+		expectedResp: false,
+		message:      "samefield false",
+	},
+	{
+		expStr: `sameparent("tag1", "tag2:customers", 1)`,
+		fieldPathByTag: map[string][]string{
+			"tag1": {"customers.index(0).name", "customers.index(1).name"},
+			"tag2": {"customers.index(1).ssn", "employees.index(0).ssn"},
+		},
+		expectedResp: true,
+		message:      "sameparent true",
+	},
+	{
+		expStr: `sameparent("tag1", "tag2", "tag3", 1)`,
+		fieldPathByTag: map[string][]string{
+			"tag1": {"customers.index(0).name"},
+			"tag2": {"customers.index(0).ssn"},
+			"tag3": {"customers.index(1).email"},
+		},
+		expectedResp: false,
+		message:      "sameparent different elements",
+	},
+	{
+		expStr: `not sameparent("tag1", "tag2", 2) and "tag1"`,
+		fieldPathByTag: map[string][]string{
+			"tag1": {"customers.index(0).name"},
+			"tag2": {"employees.index(0).ssn"},
+		},
+		expectedResp: true,
+		message:      "sameparent without shared ancestor",
+	},
+	{
+		expStr: `"tag1" and not rule("rule1")`,
+		fieldPathByTag: map[string][]string{
+			"tag1": {"field1"},
+		},
+		expectedResp: true,
+		message:      "rule reference without fired rules",
+	},
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+	tag := &Expression{Type: UNIT_EXPR, Tag: TagInfo{Name: "tag1"}}
+	tests := []struct {
+		exp         *Expression
+		expectedErr error
+		message     string
+	}{
+		{
+			exp:         &Expression{Type: AND_EXPR, LExpr: tag, RExpr: &Expression{Type: NOT_EXPR, RExpr: tag}},
+			expectedErr: nil,
+			message:     "valid expression",
+		},
+		{
+			exp:         &Expression{Type: AND_EXPR, LExpr: tag, RExpr: &Expression{Type: OR_EXPR, LExpr: tag}},
+			expectedErr: fmt.Errorf("OR statement do not have right or left expression: \"tag1\" or "),
+			message:     "invalid sub expression",
+		},
+		{
+			exp:         &Expression{Type: NOT_EXPR, RExpr: &Expression{Type: UNIT_EXPR}},
+			expectedErr: fmt.Errorf("UNIT statement do not have tag: \"\""),
+			message:     "unit without tag",
+		},
+		{
+			exp:         &Expression{Type: OR_EXPR, LExpr: tag, RExpr: &Expression{Type: RULE_EXPR}},
+			expectedErr: fmt.Errorf("RULE statement do not have rule name: rule(\"\")"),
+			message:     "rule without name",
+		},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(tc.expectedErr, tc.exp.Validate(), tc.message)
+	}
+}
+
+func TestSolveShortCircuit(t *testing.T) {
+	assert := assert.New(t)
+	missing := &Expression{Type: UNIT_EXPR, Tag: TagInfo{Name: "missing"}}
+	found := &Expression{Type: UNIT_EXPR, Tag: TagInfo{Name: "found"}}
+	invalid := &Expression{Type: NOT_EXPR}
+	fieldPathByTag := map[string][]string{"found": {"field1"}}
+	tests := []struct {
+		exp          *Expression
+		expectedResp bool
+		expectedErr  error
+		message      string
+	}{
+		{
+			exp:          &Expression{Type: AND_EXPR, LExpr: missing, RExpr: invalid},
+			expectedResp: false,
+			expectedErr:  nil,
+			message:      "and with false left side",
+		},
+		{
+			exp:          &Expression{Type: OR_EXPR, LExpr: found, RExpr: invalid},
+			expectedResp: true,
+			expectedErr:  nil,
+			message:      "or with true left side",
+		},
+		{
+			exp:          &Expression{Type: AND_EXPR, LExpr: found, RExpr: invalid},
+			expectedResp: false,
+			expectedErr:  fmt.Errorf("NOT statement do not have expression: not "),
+			message:      "and with true left side",
+		},
+		{
+			exp:          &Expression{Type: OR_EXPR, LExpr: missing, RExpr: invalid},
+			expectedResp: false,
+			expectedErr:  fmt.Errorf("NOT statement do not have expression: not "),
+			message:      "or with false left side",
+		},
+	}
+
+	for _, tc := range tests {
+		resp, err := tc.exp.Solve(fieldPathByTag)
+		assert.Equal(tc.expectedErr, err, tc.message)
+		assert.Equal(tc.expectedResp, resp, tc.message)
+	}
+
+	for _, tc := range solverTestCases {
+		exp, err := NewParser(strings.NewReader(tc.expStr)).Parse()
+		assert.Nil(err, tc.message)
+		resp, err := exp.Solve(tc.fieldPathByTag)
+		assert.Nil(err, tc.message)
+		assert.Equal(solveAll(exp, tc.fieldPathByTag), resp, tc.message+" same as full evaluation")
+	}
+}
+
+// solveAll solves the expression evaluating both sides of all AND and OR
+// expressions. It is used as reference to the short circuit evaluation.
+func solveAll(exp *Expression, fieldPathByTag map[string][]string) bool {
+	switch exp.Type {
+	case UNIT_EXPR:
+		fieldPaths, ok := fieldPathByTag[exp.Tag.Name]
+		if !ok {
+			return false
+		}
+		if exp.Tag.FieldPath == "" {
+			return true
+		}
+		for _, fieldPath := range fieldPaths {
+			if MatchFieldPath(exp.Tag.FieldPath, fieldPath) {
+				return true
+			}
+		}
+		return false
+	case AND_EXPR:
+		lval := solveAll(exp.LExpr, fieldPathByTag)
+		rval := solveAll(exp.RExpr, fieldPathByTag)
+		return lval && rval
+	case OR_EXPR:
+		lval := solveAll(exp.LExpr, fieldPathByTag)
+		rval := solveAll(exp.RExpr, fieldPathByTag)
+		return lval || rval
+	case NOT_EXPR:
+		return !solveAll(exp.RExpr, fieldPathByTag)
+	case ATLEAST_EXPR:
+		trueCount := 0
+		for _, operand := range exp.Exprs {
+			if solveAll(operand, fieldPathByTag) {
+				trueCount++
+			}
+		}
+		return trueCount >= exp.Count
+	case COUNT_EXPR:
+		return exp.Operator.Compare(exp.countFieldPaths(fieldPathByTag, SolveOptions{}), exp.Count)
+	case SAMEPARENT_EXPR:
+		shared, _ := exp.sharedAncestors(fieldPathByTag, SolveOptions{})
+		return len(shared) > 0
+	default:
+		return exp.Type == TRUE_EXPR
+	}
+}
+
+// deepTree returns a balanced tree with 2^depth tags where the
+// levels alternate between AND and OR expressions.
+func deepTree(depth int, count *int) *Expression {
+	if depth == 0 {
+		*count++
+		return &Expression{Type: UNIT_EXPR, Tag: TagInfo{Name: fmt.Sprintf("tag%d", *count), FieldPath: "field"}}
+	}
+
+	expType := AND_EXPR
+	if depth%2 == 0 {
+		expType = OR_EXPR
+	}
+	return &Expression{
+		Type:  expType,
+		LExpr: deepTree(depth-1, count),
+		RExpr: deepTree(depth-1, count),
+	}
+}
+
+func BenchmarkSolveDeepTree(b *testing.B) {
+	count := 0
+	exp := deepTree(14, &count)
+	fieldPathByTag := make(map[string][]string)
+	for i := 1; i <= count; i += 2 {
+		fieldPathByTag[fmt.Sprintf("tag%d", i)] = []string{"field.inner"}
+	}
+
+	b.Run("short circuit", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = exp.Solve(fieldPathByTag)
+		}
+	})
+	b.Run("full evaluation", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_ = solveAll(exp, fieldPathByTag)
+		}
+	})
 }
@@ -0,0 +1,167 @@
+package dsl
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// FieldPathMatching is how the plain field paths (not globs or regexes) are matched
+// with the field paths where the tags were found.
+type FieldPathMatching int
+
+const (
+	// SegmentMatching matches the field paths that are equal to the path or that are
+	// inside it, eg: "user" matches "user", "user.name" and "user.index(0)" but
+	// not "username". It is the default.
+	SegmentMatching FieldPathMatching = iota
+	// PrefixMatching matches the field paths that start with the path,
+	// eg: "user" matches "user.name" and "username".
+	PrefixMatching
+)
+
+// MatchFieldPath returns true if the field path where a tag was found matches
+// the field path of a TagInfo. The field path of the TagInfo can be:
+//   - a regex between slashes (eg: /^user\.(email|phone)$/), that matches
+//     if the regex matches any part of the field path.
+//   - a glob (any path with '*'), that is matched segment by segment against the
+//     start of the field path, the segments are separated by '.'. "**" matches
+//     any number of segments and the other segments are matched using path.Match,
+//     eg: "*.email", "items.index(*).name" or "**.id".
+//   - a plain path, that matches the field path itself and the field paths inside
+//     it (see SegmentMatching).
+//
+// Invalid glob and regex field paths never match, see ValidateFieldPath.
+// The glob and regex field paths are compiled on each call, see CompileFieldPaths.
+func MatchFieldPath(pattern string, fieldPath string) bool {
+	return SegmentMatching.Match(pattern, fieldPath)
+}
+
+// Match is the same as MatchFieldPath but the plain paths are matched using m.
+func (m FieldPathMatching) Match(pattern string, fieldPath string) bool {
+	return FieldPathMatchers(nil).Match(m, pattern, fieldPath)
+}
+
+// FieldPathMatchers are the compiled glob and regex field paths, so they can be matched
+// many times without being compiled again. The invalid field paths never match.
+type FieldPathMatchers map[string]func(string) bool
+
+// CompileFieldPaths returns the FieldPathMatchers of the glob and regex field paths,
+// the plain paths are ignored.
+func CompileFieldPaths(patterns []string) FieldPathMatchers {
+	fpm := make(FieldPathMatchers)
+	for _, pattern := range patterns {
+		if !isRegexFieldPath(pattern) && !isGlobFieldPath(pattern) {
+			continue
+		}
+		if _, ok := fpm[pattern]; ok {
+			continue
+		}
+		matcher, err := compileFieldPath(pattern)
+		if err != nil {
+			matcher = func(string) bool { return false }
+		}
+		fpm[pattern] = matcher
+	}
+	return fpm
+}
+
+// Match is the same as FieldPathMatching.Match but the glob and regex field paths are matched
+// using their compiled matchers. The field paths that were not compiled are compiled on each call.
+func (fpm FieldPathMatchers) Match(matching FieldPathMatching, pattern string, fieldPath string) bool {
+	if !isRegexFieldPath(pattern) && !isGlobFieldPath(pattern) {
+		if matching == PrefixMatching {
+			return strings.HasPrefix(fieldPath, pattern)
+		}
+		return matchSegmentPrefix(pattern, fieldPath)
+	}
+
+	if matcher, ok := fpm[pattern]; ok {
+		return matcher(fieldPath)
+	}
+	matcher, err := compileFieldPath(pattern)
+	if err != nil {
+		return false
+	}
+	return matcher(fieldPath)
+}
+
+// ValidateFieldPath returns an error if the field path is an invalid glob or regex.
+func ValidateFieldPath(pattern string) error {
+	_, err := compileFieldPath(pattern)
+	return err
+}
+
+// compileFieldPath returns the function that matches the field paths with the glob or
+// regex pattern. It returns a nil function for the plain paths.
+func compileFieldPath(pattern string) (func(string) bool, error) {
+	switch {
+	case isRegexFieldPath(pattern):
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid field path regex %s: %s", pattern, err)
+		}
+		return re.MatchString, nil
+
+	case isGlobFieldPath(pattern):
+		segments := strings.Split(pattern, ".")
+		for _, seg := range segments {
+			if _, err := path.Match(seg, ""); err != nil {
+				return nil, fmt.Errorf("invalid field path glob %s: %s", pattern, err)
+			}
+		}
+		return func(fieldPath string) bool {
+			return matchSegments(segments, strings.Split(fieldPath, "."))
+		}, nil
+
+	default:
+		return nil, nil
+	}
+}
+
+// matchSegmentPrefix returns true if the field path is equal to the path or if it
+// continues with a new segment after the path.
+func matchSegmentPrefix(pattern string, fieldPath string) bool {
+	if !strings.HasPrefix(fieldPath, pattern) {
+		return false
+	}
+	if len(fieldPath) == len(pattern) || pattern == "" || strings.HasSuffix(pattern, ".") {
+		return true
+	}
+	return fieldPath[len(pattern)] == '.'
+}
+
+// matchSegments returns true if the glob segments match the start of the field path segments.
+func matchSegments(pattern []string, segments []string) bool {
+	if len(pattern) == 0 {
+		return true
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(segments) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], segments[1:])
+}
+
+// isRegexFieldPath returns true if the field path is a regex between slashes.
+func isRegexFieldPath(pattern string) bool {
+	return len(pattern) >= 2 && pattern[0] == '/' && pattern[len(pattern)-1] == '/'
+}
+
+// isGlobFieldPath returns true if the field path has wildcards.
+func isGlobFieldPath(pattern string) bool {
+	return strings.Contains(pattern, "*")
+}
@@ -0,0 +1,306 @@
+package dsl
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchFieldPath(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		pattern   string
+		fieldPath string
+		expected  bool
+		message   string
+	}{
+		{
+			pattern:   "Field3",
+			fieldPath: "Field3.name",
+			expected:  true,
+			message:   "plain path",
+		},
+		{
+			pattern:   "Field3",
+			fieldPath: "Field3Extra.name",
+			expected:  false,
+			message:   "plain path respects the segment boundaries",
+		},
+		{
+			pattern:   "Field3",
+			fieldPath: "Field1.Field3",
+			expected:  false,
+			message:   "plain path not on the start",
+		},
+		{
+			pattern:   "*.email",
+			fieldPath: "user.email",
+			expected:  true,
+			message:   "glob single segment",
+		},
+		{
+			pattern:   "*.email",
+			fieldPath: "user.email.domain",
+			expected:  true,
+			message:   "glob matches the start of the field path",
+		},
+		{
+			pattern:   "*.email",
+			fieldPath: "user.address.email",
+			expected:  false,
+			message:   "glob single segment do not match many segments",
+		},
+		{
+			pattern:   "*.email",
+			fieldPath: "user.emails",
+			expected:  false,
+			message:   "glob respects the segment boundaries",
+		},
+		{
+			pattern:   "**.id",
+			fieldPath: "id",
+			expected:  true,
+			message:   "glob double star zero segments",
+		},
+		{
+			pattern:   "**.id",
+			fieldPath: "user.groups.index(2).id",
+			expected:  true,
+			message:   "glob double star many segments",
+		},
+		{
+			pattern:   "**.id",
+			fieldPath: "user.name",
+			expected:  false,
+			message:   "glob double star no match",
+		},
+		{
+			pattern:   "items.index(*).name",
+			fieldPath: "items.index(10).name",
+			expected:  true,
+			message:   "glob inside segment",
+		},
+		{
+			pattern:   "items.index(*).name",
+			fieldPath: "items.index(10).description",
+			expected:  false,
+			message:   "glob inside segment no match",
+		},
+		{
+			pattern:   `/^user\.(email|phone)$/`,
+			fieldPath: "user.phone",
+			expected:  true,
+			message:   "regex",
+		},
+		{
+			pattern:   `/^user\.(email|phone)$/`,
+			fieldPath: "user.phone.number",
+			expected:  false,
+			message:   "regex anchored",
+		},
+		{
+			pattern:   `/name/`,
+			fieldPath: "user.firstname",
+			expected:  true,
+			message:   "regex not anchored",
+		},
+		{
+			pattern:   `/(/`,
+			fieldPath: "(",
+			expected:  false,
+			message:   "invalid regex never matches",
+		},
+		{
+			pattern:   "[*",
+			fieldPath: "[a",
+			expected:  false,
+			message:   "invalid glob never matches",
+		},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(tc.expected, MatchFieldPath(tc.pattern, tc.fieldPath), tc.message)
+		matchers := CompileFieldPaths([]string{tc.pattern})
+		assert.Equal(tc.expected, matchers.Match(SegmentMatching, tc.pattern, tc.fieldPath), tc.message+" compiled")
+	}
+}
+
+func TestCompileFieldPaths(t *testing.T) {
+	assert := assert.New(t)
+	matchers := CompileFieldPaths([]string{"user", "*.email", "*.email", "/(/", "/^id$/"})
+	var patterns []string
+	for pattern := range matchers {
+		patterns = append(patterns, pattern)
+	}
+	assert.ElementsMatch([]string{"*.email", "/(/", "/^id$/"}, patterns, "plain paths are not compiled")
+	assert.False(matchers["/(/"]("("), "invalid field path never matches")
+	assert.True(matchers.Match(PrefixMatching, "user", "username"), "plain path uses the matching")
+	assert.True(matchers.Match(SegmentMatching, "**.id", "user.id"), "field path not compiled")
+
+	exp, err := NewParser(strings.NewReader(`"tag1:*.email"`)).Parse()
+	assert.Nil(err)
+	fieldPathByTag := map[string][]string{"tag1": {"email"}}
+	res, err := exp.SolveWithOptions(fieldPathByTag, SolveOptions{})
+	assert.Nil(err)
+	assert.False(res, "field paths compiled on solve")
+
+	res, err = exp.SolveWithOptions(fieldPathByTag, SolveOptions{
+		FieldPaths: FieldPathMatchers{"*.email": func(string) bool { return true }},
+	})
+	assert.Nil(err)
+	assert.True(res, "given compiled field paths")
+}
+
+func TestValidateFieldPath(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		pattern     string
+		expectedErr error
+		message     string
+	}{
+		{
+			pattern: "field1.field2",
+			message: "prefix",
+		},
+		{
+			pattern: "**.index(*)",
+			message: "glob",
+		},
+		{
+			pattern: `/^a\.b$/`,
+			message: "regex",
+		},
+		{
+			pattern:     `/(/`,
+			expectedErr: fmt.Errorf("invalid field path regex /(/: error parsing regexp: missing closing ): `(`"),
+			message:     "invalid regex",
+		},
+		{
+			pattern:     "a.[*",
+			expectedErr: fmt.Errorf("invalid field path glob a.[*: syntax error in pattern"),
+			message:     "invalid glob",
+		},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(tc.expectedErr, ValidateFieldPath(tc.pattern), tc.message)
+	}
+}
+
+func TestParserFieldPathPatterns(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		expStr      string
+		expectedExp *Expression
+		expectedErr error
+		message     string
+	}{
+		{
+			expStr:      `"tag1:**.email"`,
+			expectedExp: &Expression{Type: UNIT_EXPR, Tag: TagInfo{Name: "tag1", FieldPath: "**.email"}},
+			message:     "glob",
+		},
+		{
+			expStr:      `"tag1:/^a\.b$/"`,
+			expectedExp: &Expression{Type: UNIT_EXPR, Tag: TagInfo{Name: "tag1", FieldPath: `/^a\.b$/`}},
+			message:     "regex keeps the escaped chars",
+		},
+		{
+			expStr: `"tag1" and "tag2:/(/"`,
+			expectedErr: &ParseError{
+				Pos:   Position{Offset: 16, Line: 1, Column: 17},
+				Token: FIELD_PATH,
+				Lit:   "/(/",
+				Msg:   "invalid expression: invalid field path regex /(/: error parsing regexp: missing closing ): `(`",
+			},
+			message: "invalid regex",
+		},
+	}
+
+	for _, tc := range tests {
+		p := NewParser(strings.NewReader(tc.expStr))
+		exp, err := p.Parse()
+		assert.Equal(tc.expectedErr, err, tc.message)
+		assert.Equal(tc.expectedExp, exp, tc.message)
+		if exp == nil {
+			continue
+		}
+
+		roundTrip, err := NewParser(strings.NewReader(exp.Format())).Parse()
+		assert.Nil(err, tc.message)
+		assert.Equal(exp, roundTrip, tc.message)
+	}
+}
+
+func TestSolveFieldPathPatterns(t *testing.T) {
+	assert := assert.New(t)
+	fieldPathByTag := map[string][]string{
+		"email": {"user.email", "contacts.index(0).email"},
+		"id":    {"user.groups.index(1).id"},
+	}
+	tests := []struct {
+		expStr   string
+		expected bool
+		message  string
+	}{
+		{expStr: `"email:contacts.index(*).email"`, expected: true, message: "glob"},
+		{expStr: `"email:*.phone"`, expected: false, message: "glob no match"},
+		{expStr: `"id:**.id" and "email:/^user\./"`, expected: true, message: "double star and regex"},
+		{expStr: `"id:/^id$/"`, expected: false, message: "regex no match"},
+	}
+
+	for _, tc := range tests {
+		exp, err := NewParser(strings.NewReader(tc.expStr)).Parse()
+		assert.Nil(err, tc.message)
+		res, err := exp.Solve(fieldPathByTag)
+		assert.Nil(err, tc.message)
+		assert.Equal(tc.expected, res, tc.message)
+
+		expl, err := exp.Explain(fieldPathByTag)
+		assert.Nil(err, tc.message)
+		assert.Equal(tc.expected, expl.Value, tc.message)
+	}
+}
+
+func TestFieldPathMatching(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		pattern         string
+		fieldPath       string
+		expectedSegment bool
+		expectedPrefix  bool
+		message         string
+	}{
+		{pattern: "user", fieldPath: "user", expectedSegment: true, expectedPrefix: true, message: "equal"},
+		{pattern: "user", fieldPath: "user.name", expectedSegment: true, expectedPrefix: true, message: "child"},
+		{pattern: "user", fieldPath: "user.index(0)", expectedSegment: true, expectedPrefix: true, message: "index"},
+		{pattern: "user", fieldPath: "username", expectedSegment: false, expectedPrefix: true, message: "same prefix"},
+		{pattern: "user.name", fieldPath: "user.names.first", expectedSegment: false, expectedPrefix: true, message: "same inner prefix"},
+		{pattern: "user.", fieldPath: "user.name", expectedSegment: true, expectedPrefix: true, message: "ending with dot"},
+		{pattern: "", fieldPath: "user", expectedSegment: true, expectedPrefix: true, message: "empty"},
+		{pattern: "user", fieldPath: "use", expectedSegment: false, expectedPrefix: false, message: "shorter"},
+		{pattern: "*", fieldPath: "username.first", expectedSegment: true, expectedPrefix: true, message: "glob is not changed"},
+		{pattern: "/^user$/", fieldPath: "username", expectedSegment: false, expectedPrefix: false, message: "regex is not changed"},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(tc.expectedSegment, SegmentMatching.Match(tc.pattern, tc.fieldPath), tc.message+" segment")
+		assert.Equal(tc.expectedPrefix, PrefixMatching.Match(tc.pattern, tc.fieldPath), tc.message+" prefix")
+	}
+
+	exp, err := NewParser(strings.NewReader(`"tag1:user"`)).Parse()
+	assert.Nil(err)
+	fieldPathByTag := map[string][]string{"tag1": {"username"}}
+	for _, matching := range []FieldPathMatching{SegmentMatching, PrefixMatching} {
+		msg := fmt.Sprintf("matching %d", matching)
+		res, err := exp.SolveWithMatching(fieldPathByTag, matching)
+		assert.Nil(err, msg)
+		assert.Equal(matching == PrefixMatching, res, msg)
+
+		expl, err := exp.ExplainWithMatching(fieldPathByTag, matching)
+		assert.Nil(err, msg)
+		assert.Equal(matching == PrefixMatching, expl.Value, msg)
+	}
+}
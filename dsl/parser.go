@@ -3,6 +3,7 @@ package dsl
 import (
 	"fmt"
 	"io"
+	"strconv"
 )
 
 // Parser parser struct that holds needed information to
@@ -10,13 +11,15 @@ import (
 type Parser struct {
 	s   *Scanner
 	buf struct {
-		tok       Token  // last read token
-		lit       string // last read literal
-		unscanned bool   // if it was unscanned
+		tok       Token    // last read token
+		lit       string   // last read literal
+		pos       Position // position of the last read token
+		unscanned bool     // if it was unscanned
 	}
-	parCount int
-	fields   map[string]struct{}
-	tags     map[string]struct{}
+	parCount    int
+	fields      map[string]struct{}
+	tags        map[string]struct{}
+	leftToRight bool
 }
 
 // NewParser returns a new instance of Parser.
@@ -30,13 +33,417 @@ func NewParser(r io.Reader) *Parser {
 	}
 }
 
+// SetLeftToRight sets if the expression must be built strictly from left to right,
+// ignoring the precedence of the operators. This is the behavior of the older
+// versions of the parser and it is kept for compatibility.
+// Eg: "a" or "b" and "c" is parsed as ("a" or "b") and "c"
+func (p *Parser) SetLeftToRight(leftToRight bool) {
+	p.leftToRight = leftToRight
+}
+
 // Parse parses the expression and returns the root node
-// of the parsed expression.
+// of the parsed expression. The operators have the precedence
+// NOT > AND > OR and AND and OR are left associative,
+// unless SetLeftToRight was set. The operands of the quantifiers
+// (atleast and anyof) are always parsed using the precedence.
+// If the expression is invalid the error is a *ParseError.
+// The parsed expression is validated (see Expression.Validate).
 func (p *Parser) Parse() (expr *Expression, err error) {
-	return p.parse()
+	if p.leftToRight {
+		expr, err = p.parse()
+	} else {
+		expr, err = p.parsePrecedence()
+	}
+	if err != nil {
+		return expr, err
+	}
+
+	if err = expr.Validate(); err != nil {
+		return nil, err
+	}
+	return expr, nil
+}
+
+// parsePrecedence parses the whole expression using the precedence of the operators.
+func (p *Parser) parsePrecedence() (*Expression, error) {
+	exp, err := p.parseBinary(0, UNSET_EXPR)
+	if err != nil {
+		return nil, err
+	}
+
+	tok, lit, err := p.scanIgnoreWhitespace()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok {
+	case EOF:
+		return exp, nil
+	case CLPAR:
+		pos := p.buf.pos
+		extra := 1
+		for {
+			tok, _, err = p.scanIgnoreWhitespace()
+			if err != nil {
+				return nil, err
+			}
+			if tok != CLPAR {
+				break
+			}
+			extra++
+		}
+		return nil, &ParseError{
+			Pos:      pos,
+			Token:    CLPAR,
+			Lit:      ")",
+			Expected: []Token{AND, OR, EOF},
+			Msg:      fmt.Sprintf("invalid expression: unexpected EOF found. Extra closing parentheses: %d", extra),
+		}
+	default:
+		return nil, p.errorf([]Token{AND, OR, EOF}, "invalid expression: Unexpected token '%s' (%s)", tok.getName(), lit)
+	}
+}
+
+// binaryPrecedence returns the precedence and the expression type of a binary operator.
+// ok is false if the token is not a binary operator.
+func binaryPrecedence(tok Token) (prec int, expType ExprType, ok bool) {
+	switch tok {
+	case OR:
+		return 1, OR_EXPR, true
+	case AND:
+		return 2, AND_EXPR, true
+	default:
+		return 0, UNSET_EXPR, false
+	}
+}
+
+// parseBinary parses the operand and all the following binary operators that have
+// precedence of at least minPrec (precedence climbing). after is the type of the
+// operator that precedes the operand and it is used on the error messages.
+func (p *Parser) parseBinary(minPrec int, after ExprType) (*Expression, error) {
+	lhs, err := p.parseOperand(after)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		tok, _, err := p.scanIgnoreWhitespace()
+		if err != nil {
+			return nil, err
+		}
+
+		prec, expType, ok := binaryPrecedence(tok)
+		if !ok || prec < minPrec {
+			p.unscan()
+			return lhs, nil
+		}
+
+		// prec + 1 makes the operators left associative
+		rhs, err := p.parseBinary(prec+1, expType)
+		if err != nil {
+			return nil, err
+		}
+
+		lhs = &Expression{
+			Type:  expType,
+			LExpr: lhs,
+			RExpr: rhs,
+		}
+	}
+}
+
+// parseOperand parses a tag, a constant, a quantifier, a co-location, a rule reference, a negated
+// operand or an expression inside parentheses. after is the type of the operator that precedes the operand.
+func (p *Parser) parseOperand(after ExprType) (*Expression, error) {
+	tok, lit, err := p.scanIgnoreWhitespace()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok {
+	case TAG:
+		p.unscan()
+		tag, err := p.parseTagInfo()
+		if err != nil {
+			return nil, err
+		}
+		p.addTagInfo(tag)
+		return &Expression{
+			Type: UNIT_EXPR,
+			Tag:  tag,
+		}, nil
+
+	case TRUE, FALSE:
+		return constantExpression(tok), nil
+
+	case ATLEAST, ANYOF, COUNT:
+		return p.parseQuantifier(tok)
+
+	case SAMEFIELD, SAMEPARENT:
+		return p.parseColocation(tok)
+
+	case RULE:
+		return p.parseRuleReference()
+
+	case NOT:
+		operand, err := p.parseOperand(NOT_EXPR)
+		if err != nil {
+			return nil, err
+		}
+		return &Expression{
+			Type:  NOT_EXPR,
+			RExpr: operand,
+		}, nil
+
+	case OPPAR:
+		exp, err := p.parseBinary(0, UNSET_EXPR)
+		if err != nil {
+			return nil, err
+		}
+		closeTok, _, err := p.scanIgnoreWhitespace()
+		if err != nil {
+			return nil, err
+		}
+		if closeTok != CLPAR {
+			return nil, p.errorf([]Token{AND, OR, CLPAR}, "invalid expression: Unexpected '('")
+		}
+		return exp, nil
+	}
+
+	switch {
+	case after == NOT_EXPR:
+		return nil, p.errorf(operandTokens, "invalid expression: Unexpected token '%s' after NOT", tok.getName())
+	case tok == AND || tok == OR:
+		_, expType, _ := binaryPrecedence(tok)
+		return nil, p.errorf(operandTokens, "invalid expression: no left expression was found for %s", expType.GetName())
+	case after == AND_EXPR || after == OR_EXPR:
+		return nil, p.errorf(operandTokens, "invalid expression: incomplete expression %s", after.GetName())
+	case tok == EOF:
+		return nil, p.errorf(operandTokens, "invalid expression: unexpected EOF found")
+	default:
+		return nil, p.errorf(operandTokens, "invalid expression: Unexpected token '%s' (%s)", tok.getName(), lit)
+	}
+}
+
+// operandTokens are the tokens that can start an operand.
+var operandTokens = []Token{TAG, TRUE, FALSE, ATLEAST, ANYOF, COUNT, SAMEFIELD, SAMEPARENT, RULE, OPPAR, NOT}
+
+// compareTokens are the tokens of the comparisons of COUNT.
+var compareTokens = []Token{EQ, NEQ, LT, LTE, GT, GTE}
+
+// parseQuantifier parses the arguments of the ATLEAST, ANYOF or COUNT token that was scanned.
+// Eg: atleast(2, "a", "b", "c"), anyof("a", "b") or count("a:field") >= 2
+func (p *Parser) parseQuantifier(tok Token) (*Expression, error) {
+	if err := p.expect(OPPAR, "invalid expression: expected '(' after %s", tok.getName()); err != nil {
+		return nil, err
+	}
+	if tok == COUNT {
+		return p.parseCount()
+	}
+
+	exp := &Expression{Type: ATLEAST_EXPR, Count: 1}
+	var countPos Position
+	var countLit string
+	if tok == ATLEAST {
+		nextTok, lit, err := p.scanIgnoreWhitespace()
+		if err != nil {
+			return nil, err
+		}
+		if nextTok != NUMBER {
+			return nil, p.errorf([]Token{NUMBER}, "invalid expression: expected the number of expressions of ATLEAST but found %s", nextTok.getName())
+		}
+		exp.Count, err = strconv.Atoi(lit)
+		if err != nil {
+			return nil, p.errorf(nil, "invalid expression: invalid number %s", lit)
+		}
+		// the count is validated after the number of expressions is known
+		countPos, countLit = p.buf.pos, lit
+		if err := p.expect(COMMA, "invalid expression: expected ',' after the number of ATLEAST"); err != nil {
+			return nil, err
+		}
+	}
+
+	for {
+		operand, err := p.parseBinary(0, UNSET_EXPR)
+		if err != nil {
+			return nil, err
+		}
+		exp.Exprs = append(exp.Exprs, operand)
+
+		nextTok, lit, err := p.scanIgnoreWhitespace()
+		if err != nil {
+			return nil, err
+		}
+		if nextTok == CLPAR {
+			break
+		}
+		if nextTok != COMMA {
+			return nil, p.errorf([]Token{AND, OR, COMMA, CLPAR}, "invalid expression: Unexpected token '%s' (%s) on %s", nextTok.getName(), lit, tok.getName())
+		}
+	}
+
+	if tok == ATLEAST && (exp.Count < 1 || exp.Count > len(exp.Exprs)) {
+		return nil, &ParseError{
+			Pos:   countPos,
+			Token: NUMBER,
+			Lit:   countLit,
+			Msg:   fmt.Sprintf("invalid expression: ATLEAST count must be between 1 and the number of expressions (%d)", len(exp.Exprs)),
+		}
+	}
+	return exp, nil
+}
+
+// parseCount parses the tag, the comparison and the number of a COUNT after the '('.
+func (p *Parser) parseCount() (*Expression, error) {
+	tag, err := p.parseTagInfo()
+	if err != nil {
+		return nil, err
+	}
+	p.addTagInfo(tag)
+	if err := p.expect(CLPAR, "invalid expression: expected ')' after the tag of COUNT"); err != nil {
+		return nil, err
+	}
+
+	tok, _, err := p.scanIgnoreWhitespace()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := compareOpByToken(tok)
+	if !ok {
+		return nil, p.errorf(compareTokens, "invalid expression: expected a comparison after COUNT but found %s", tok.getName())
+	}
+
+	tok, lit, err := p.scanIgnoreWhitespace()
+	if err != nil {
+		return nil, err
+	}
+	if tok != NUMBER {
+		return nil, p.errorf([]Token{NUMBER}, "invalid expression: expected a number after the comparison of COUNT but found %s", tok.getName())
+	}
+	count, err := strconv.Atoi(lit)
+	if err != nil {
+		return nil, p.errorf(nil, "invalid expression: invalid number %s", lit)
+	}
+
+	return &Expression{
+		Type:     COUNT_EXPR,
+		Tag:      tag,
+		Operator: op,
+		Count:    count,
+	}, nil
+}
+
+// parseColocation parses the arguments of the SAMEFIELD or SAMEPARENT token that was scanned.
+// The arguments are at least 2 tags and SAMEPARENT ends with the depth.
+// Eg: samefield("a", "b:customers") or sameparent("a", "b", 1)
+func (p *Parser) parseColocation(tok Token) (*Expression, error) {
+	if err := p.expect(OPPAR, "invalid expression: expected '(' after %s", tok.getName()); err != nil {
+		return nil, err
+	}
+
+	exp := &Expression{Type: SAMEPARENT_EXPR}
+	for {
+		nextTok, lit, err := p.scanIgnoreWhitespace()
+		if err != nil {
+			return nil, err
+		}
+		if nextTok == NUMBER && tok == SAMEPARENT && len(exp.Exprs) >= 2 {
+			exp.Depth, err = strconv.Atoi(lit)
+			if err != nil {
+				return nil, p.errorf(nil, "invalid expression: invalid number %s", lit)
+			}
+			if err := p.expect(CLPAR, "invalid expression: expected ')' after the depth of SAMEPARENT"); err != nil {
+				return nil, err
+			}
+			return exp, nil
+		}
+		p.unscan()
+
+		tag, err := p.parseTagInfo()
+		if err != nil {
+			return nil, err
+		}
+		p.addTagInfo(tag)
+		exp.Exprs = append(exp.Exprs, &Expression{Type: UNIT_EXPR, Tag: tag})
+
+		nextTok, lit, err = p.scanIgnoreWhitespace()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case nextTok == COMMA:
+			continue
+		case nextTok != CLPAR:
+			return nil, p.errorf([]Token{COMMA, CLPAR}, "invalid expression: Unexpected token '%s' (%s) on %s", nextTok.getName(), lit, tok.getName())
+		case len(exp.Exprs) < 2:
+			return nil, p.errorf([]Token{COMMA}, "invalid expression: %s needs at least 2 tags", tok.getName())
+		case tok == SAMEPARENT:
+			return nil, p.errorf([]Token{COMMA}, "invalid expression: expected the depth of SAMEPARENT")
+		}
+		return exp, nil
+	}
+}
+
+// parseRuleReference parses the name of the rule after the RULE token that was scanned.
+// Eg: rule("name")
+func (p *Parser) parseRuleReference() (*Expression, error) {
+	if err := p.expect(OPPAR, "invalid expression: expected '(' after RULE"); err != nil {
+		return nil, err
+	}
+	tag, err := p.parseTagInfo()
+	if err != nil {
+		return nil, err
+	}
+	if tag.FieldPath != "" {
+		return nil, p.errorf(nil, "invalid expression: rule reference can not have a field path")
+	}
+	if err := p.expect(CLPAR, "invalid expression: expected ')' after the name of the rule"); err != nil {
+		return nil, err
+	}
+	return &Expression{Type: RULE_EXPR, RuleName: tag.Name}, nil
+}
+
+// expect scans the next token and returns a ParseError with the given message if it is not tok.
+func (p *Parser) expect(tok Token, format string, a ...interface{}) error {
+	nextTok, _, err := p.scanIgnoreWhitespace()
+	if err != nil {
+		return err
+	}
+	if nextTok != tok {
+		return p.errorf([]Token{tok}, format, a...)
+	}
+	return nil
+}
+
+// constantExpression returns the expression of the TRUE or FALSE token.
+func constantExpression(tok Token) *Expression {
+	if tok == TRUE {
+		return &Expression{Type: TRUE_EXPR}
+	}
+	return &Expression{Type: FALSE_EXPR}
+}
+
+// errorf returns a ParseError of the last scanned token. expected are
+// the tokens that would be valid in its place.
+func (p *Parser) errorf(expected []Token, format string, a ...interface{}) *ParseError {
+	return &ParseError{
+		Pos:      p.buf.pos,
+		Token:    p.buf.tok,
+		Lit:      p.buf.lit,
+		Expected: expected,
+		Msg:      fmt.Sprintf(format, a...),
+	}
+}
+
+// addTagInfo adds the tag and the field path to the list of unique tags and fields.
+func (p *Parser) addTagInfo(tag TagInfo) {
+	p.tags[tag.Name] = struct{}{}
+	if tag.FieldPath != "" {
+		p.fields[tag.FieldPath] = struct{}{}
+	}
 }
 
-// parse implementation of Parse()
+// parse implementation of Parse() when leftToRight is set
 func (p *Parser) parse() (*Expression, error) {
 	exp := &Expression{}
 	for {
@@ -78,6 +485,25 @@ func (p *Parser) parse() (*Expression, error) {
 				p.fields[tag.FieldPath] = struct{}{}
 			}
 
+		case TRUE, FALSE:
+			constExp := constantExpression(tok)
+			if exp.LExpr == nil {
+				exp.LExpr = constExp
+			} else {
+				exp.RExpr = constExp
+			}
+
+		case ATLEAST, ANYOF, COUNT, SAMEFIELD, SAMEPARENT, RULE:
+			quantExp, err := p.parseLegacyFunction(tok)
+			if err != nil {
+				return exp, err
+			}
+			if exp.LExpr == nil {
+				exp.LExpr = quantExp
+			} else {
+				exp.RExpr = quantExp
+			}
+
 		case AND:
 			exp, err = p.handleDualOp(exp, AND_EXPR)
 			if err != nil {
@@ -116,6 +542,15 @@ func (p *Parser) parse() (*Expression, error) {
 					p.fields[tag.FieldPath] = struct{}{}
 				}
 
+			case TRUE, FALSE:
+				notExp.RExpr = constantExpression(nextTok)
+
+			case ATLEAST, ANYOF, COUNT, SAMEFIELD, SAMEPARENT, RULE:
+				notExp.RExpr, err = p.parseLegacyFunction(nextTok)
+				if err != nil {
+					return exp, err
+				}
+
 			case OPPAR:
 				newExp, err := p.handleOpenPar()
 				if err != nil {
@@ -123,7 +558,7 @@ func (p *Parser) parse() (*Expression, error) {
 				}
 				notExp.RExpr = newExp
 			default:
-				return exp, fmt.Errorf("invalid expression: Unexpected token '%s' after NOT", nextTok.getName())
+				return exp, p.errorf([]Token{TAG, TRUE, FALSE, ATLEAST, ANYOF, COUNT, SAMEFIELD, SAMEPARENT, RULE, OPPAR}, "invalid expression: Unexpected token '%s' after NOT", nextTok.getName())
 			}
 
 			if exp.LExpr == nil {
@@ -137,7 +572,7 @@ func (p *Parser) parse() (*Expression, error) {
 			fallthrough
 		case EOF:
 			if p.parCount < 0 {
-				return exp, fmt.Errorf("invalid expression: unexpected EOF found. Extra closing parentheses: %d", p.parCount*-1)
+				return exp, p.errorf([]Token{AND, OR, EOF}, "invalid expression: unexpected EOF found. Extra closing parentheses: %d", p.parCount*-1)
 			}
 
 			finalExp := exp
@@ -147,28 +582,40 @@ func (p *Parser) parse() (*Expression, error) {
 				} else if exp.LExpr != nil {
 					finalExp = exp.LExpr
 				} else {
-					return nil, fmt.Errorf("invalid expression: unexpected EOF found")
+					return nil, p.errorf(operandTokens, "invalid expression: unexpected EOF found")
 				}
 			}
 			switch finalExp.Type {
 			case AND_EXPR, OR_EXPR:
 				if finalExp.RExpr == nil {
-					return nil, fmt.Errorf("invalid expression: incomplete expression %s", finalExp.Type.GetName())
+					return nil, p.errorf(operandTokens, "invalid expression: incomplete expression %s", finalExp.Type.GetName())
 				}
 			}
 			return finalExp, nil
 
 		default:
-			return exp, fmt.Errorf("invalid expression: Unexpected operator was found (%d = '%s')", tok, lit)
+			return exp, p.errorf([]Token{TAG, TRUE, FALSE, ATLEAST, ANYOF, COUNT, SAMEFIELD, SAMEPARENT, RULE, OPPAR, NOT, AND, OR, CLPAR, EOF}, "invalid expression: Unexpected operator was found (%d = '%s')", tok, lit)
 		}
 	}
 }
 
+// parseLegacyFunction parses the quantifier, co-location or rule reference of the
+// scanned token when leftToRight is set.
+func (p *Parser) parseLegacyFunction(tok Token) (*Expression, error) {
+	if tok == RULE {
+		return p.parseRuleReference()
+	}
+	if tok == SAMEFIELD || tok == SAMEPARENT {
+		return p.parseColocation(tok)
+	}
+	return p.parseQuantifier(tok)
+}
+
 // handleDualOp adds the needed information to the current expression and returns the next
 // expression, that can be the same or another expression.
 func (p *Parser) handleDualOp(exp *Expression, expType ExprType) (*Expression, error) {
 	if exp.LExpr == nil {
-		return exp, fmt.Errorf("invalid expression: no left expression was found for %s", expType.GetName())
+		return exp, p.errorf(operandTokens, "invalid expression: no left expression was found for %s", expType.GetName())
 	}
 	if exp.RExpr == nil {
 		exp.Type = expType
@@ -214,7 +661,7 @@ func (p *Parser) scan() (tok Token, lit string, err error) {
 	}
 
 	// Save it to the buffer in case we unscan later.
-	p.buf.tok, p.buf.lit = tok, lit
+	p.buf.tok, p.buf.lit, p.buf.pos = tok, lit, p.s.Pos()
 
 	return
 }
@@ -244,7 +691,7 @@ func (p *Parser) handleOpenPar() (*Expression, error) {
 		return newExp, err
 	}
 	if p.parCount != parlvl {
-		return newExp, fmt.Errorf("invalid expression: Unexpected '('")
+		return newExp, p.errorf([]Token{CLPAR}, "invalid expression: Unexpected '('")
 	}
 	return newExp, nil
 }
@@ -258,11 +705,11 @@ func (p *Parser) parseTagInfo() (TagInfo, error) {
 	}
 
 	if tok != TAG {
-		return tagInfo, fmt.Errorf("invalid expression: Expecting TAG but found %s", tok.getName())
+		return tagInfo, p.errorf([]Token{TAG}, "invalid expression: Expecting TAG but found %s", tok.getName())
 	}
 
 	if lit == "" {
-		return tagInfo, fmt.Errorf("invalid expression: Found empty TAG")
+		return tagInfo, p.errorf([]Token{TAG}, "invalid expression: Found empty TAG")
 	}
 
 	tagInfo.Name = lit
@@ -277,6 +724,10 @@ func (p *Parser) parseTagInfo() (TagInfo, error) {
 		return tagInfo, nil
 	}
 
+	if err := ValidateFieldPath(nextLit); err != nil {
+		return tagInfo, p.errorf(nil, "invalid expression: %s", err)
+	}
+
 	tagInfo.FieldPath = nextLit
 	return tagInfo, nil
 }
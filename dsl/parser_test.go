@@ -321,39 +321,69 @@ func TestParser(t *testing.T) {
 			expectedExp:   Expression{},
 			expectedTags:  map[string]struct{}{},
 			expectedPaths: map[string]struct{}{},
-			expectedErr:   fmt.Errorf("invalid expression: unexpected EOF found"),
-			message:       "empty expression",
+			expectedErr: &ParseError{
+				Pos:      Position{Offset: 0, Line: 1, Column: 1},
+				Token:    EOF,
+				Lit:      "",
+				Expected: operandTokens,
+				Msg:      "invalid expression: unexpected EOF found",
+			},
+			message: "empty expression",
 		},
 		{
 			expStr:        `(("tag1")`,
 			expectedExp:   Expression{},
 			expectedTags:  map[string]struct{}{},
 			expectedPaths: map[string]struct{}{},
-			expectedErr:   fmt.Errorf("invalid expression: Unexpected '('"),
-			message:       "invalid open parentheses",
+			expectedErr: &ParseError{
+				Pos:      Position{Offset: 9, Line: 1, Column: 10},
+				Token:    EOF,
+				Lit:      "",
+				Expected: []Token{AND, OR, CLPAR},
+				Msg:      "invalid expression: Unexpected '('",
+			},
+			message: "invalid open parentheses",
 		},
 		{
 			expStr:        `("tag1"))`,
 			expectedExp:   Expression{},
 			expectedTags:  map[string]struct{}{},
 			expectedPaths: map[string]struct{}{},
-			expectedErr:   fmt.Errorf("invalid expression: unexpected EOF found. Extra closing parentheses: 1"),
-			message:       "invalid close parentheses",
+			expectedErr: &ParseError{
+				Pos:      Position{Offset: 8, Line: 1, Column: 9},
+				Token:    CLPAR,
+				Lit:      ")",
+				Expected: []Token{AND, OR, EOF},
+				Msg:      "invalid expression: unexpected EOF found. Extra closing parentheses: 1",
+			},
+			message: "invalid close parentheses",
 		},
 		{
 			expStr:        `and`,
 			expectedExp:   Expression{},
 			expectedTags:  map[string]struct{}{},
 			expectedPaths: map[string]struct{}{},
-			expectedErr:   fmt.Errorf("invalid expression: no left expression was found for AND"),
-			message:       "invalid expression empty dual exp",
+			expectedErr: &ParseError{
+				Pos:      Position{Offset: 0, Line: 1, Column: 1},
+				Token:    AND,
+				Lit:      "and",
+				Expected: operandTokens,
+				Msg:      "invalid expression: no left expression was found for AND",
+			},
+			message: "invalid expression empty dual exp",
 		},
 		{
 			expStr:        ` "tag1" and `,
 			expectedExp:   Expression{},
 			expectedTags:  map[string]struct{}{},
 			expectedPaths: map[string]struct{}{},
-			expectedErr:   fmt.Errorf("invalid expression: incomplete expression AND"),
+			expectedErr: &ParseError{
+				Pos:      Position{Offset: 12, Line: 1, Column: 13},
+				Token:    EOF,
+				Lit:      "",
+				Expected: operandTokens,
+				Msg:      "invalid expression: incomplete expression AND",
+			},
 
 			message: "invalid expression incomplete dual exp",
 		},
@@ -362,7 +392,13 @@ func TestParser(t *testing.T) {
 			expectedExp:   Expression{},
 			expectedTags:  map[string]struct{}{},
 			expectedPaths: map[string]struct{}{},
-			expectedErr:   fmt.Errorf("invalid expression: no left expression was found for OR"),
+			expectedErr: &ParseError{
+				Pos:      Position{Offset: 0, Line: 1, Column: 1},
+				Token:    OR,
+				Lit:      "or",
+				Expected: operandTokens,
+				Msg:      "invalid expression: no left expression was found for OR",
+			},
 
 			message: "invalid expression empty dual exp",
 		},
@@ -371,7 +407,13 @@ func TestParser(t *testing.T) {
 			expectedExp:   Expression{},
 			expectedTags:  map[string]struct{}{},
 			expectedPaths: map[string]struct{}{},
-			expectedErr:   fmt.Errorf("invalid expression: incomplete expression OR"),
+			expectedErr: &ParseError{
+				Pos:      Position{Offset: 11, Line: 1, Column: 12},
+				Token:    EOF,
+				Lit:      "",
+				Expected: operandTokens,
+				Msg:      "invalid expression: incomplete expression OR",
+			},
 
 			message: "invalid expression incomplete dual exp",
 		},
@@ -380,8 +422,14 @@ func TestParser(t *testing.T) {
 			expectedExp:   Expression{},
 			expectedTags:  map[string]struct{}{},
 			expectedPaths: map[string]struct{}{},
-			expectedErr:   fmt.Errorf("invalid expression: Unexpected token 'EOF' after NOT"),
-			message:       "invalid expression incomplete dual exp",
+			expectedErr: &ParseError{
+				Pos:      Position{Offset: 3, Line: 1, Column: 4},
+				Token:    EOF,
+				Lit:      "",
+				Expected: operandTokens,
+				Msg:      "invalid expression: Unexpected token 'EOF' after NOT",
+			},
+			message: "invalid expression incomplete dual exp",
 		},
 	}
 
@@ -396,3 +444,689 @@ func TestParser(t *testing.T) {
 		}
 	}
 }
+
+func TestParserPrecedence(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		expStr              string
+		expectedPretty      string
+		expectedLeftToRight string
+		message             string
+	}{
+		{
+			expStr:              `"a" or "b" and "c"`,
+			expectedPretty:      "OR\n    a\n    AND\n        b\n        c\n",
+			expectedLeftToRight: "AND\n    OR\n        a\n        b\n    c\n",
+			message:             "and binds tighter than or",
+		},
+		{
+			expStr:              `"a" and "b" or "c"`,
+			expectedPretty:      "OR\n    AND\n        a\n        b\n    c\n",
+			expectedLeftToRight: "OR\n    AND\n        a\n        b\n    c\n",
+			message:             "and before or",
+		},
+		{
+			expStr:              `"a" and "b" and "c"`,
+			expectedPretty:      "AND\n    AND\n        a\n        b\n    c\n",
+			expectedLeftToRight: "AND\n    AND\n        a\n        b\n    c\n",
+			message:             "and is left associative",
+		},
+		{
+			expStr:              `"a" or "b" or "c"`,
+			expectedPretty:      "OR\n    OR\n        a\n        b\n    c\n",
+			expectedLeftToRight: "OR\n    OR\n        a\n        b\n    c\n",
+			message:             "or is left associative",
+		},
+		{
+			expStr:              `not "a" and "b"`,
+			expectedPretty:      "AND\n    NOT\n        a\n    b\n",
+			expectedLeftToRight: "AND\n    NOT\n        a\n    b\n",
+			message:             "not binds tighter than and",
+		},
+		{
+			expStr:              `"a" or not "b" and "c" or "d"`,
+			expectedPretty:      "OR\n    OR\n        a\n        AND\n            NOT\n                b\n            c\n    d\n",
+			expectedLeftToRight: "OR\n    AND\n        OR\n            a\n            NOT\n                b\n        c\n    d\n",
+			message:             "mixed operators",
+		},
+		{
+			expStr:              `("a" or "b") and "c"`,
+			expectedPretty:      "AND\n    OR\n        a\n        b\n    c\n",
+			expectedLeftToRight: "AND\n    OR\n        a\n        b\n    c\n",
+			message:             "parentheses override precedence",
+		},
+		{
+			expStr:              `"a" and ("b" or "c" and "d")`,
+			expectedPretty:      "AND\n    a\n    OR\n        b\n        AND\n            c\n            d\n",
+			expectedLeftToRight: "AND\n    a\n    AND\n        OR\n            b\n            c\n        d\n",
+			message:             "precedence inside parentheses",
+		},
+		{
+			expStr:              `not ("a" or "b") and not "c:field"`,
+			expectedPretty:      "AND\n    NOT\n        OR\n            a\n            b\n    NOT\n        c[field]\n",
+			expectedLeftToRight: "AND\n    NOT\n        OR\n            a\n            b\n    NOT\n        c[field]\n",
+			message:             "not with parentheses",
+		},
+	}
+
+	for _, tc := range tests {
+		exp, err := NewParser(strings.NewReader(tc.expStr)).Parse()
+		assert.Nil(err, tc.message)
+		assert.Equal(tc.expectedPretty, exp.PrettyFormat(), tc.message)
+
+		p := NewParser(strings.NewReader(tc.expStr))
+		p.SetLeftToRight(true)
+		exp, err = p.Parse()
+		assert.Nil(err, tc.message+" left to right")
+		assert.Equal(tc.expectedLeftToRight, exp.PrettyFormat(), tc.message+" left to right")
+	}
+}
+
+// TestParserPrecedenceExhaustive parses every combination of up to four operands,
+// negated or not, joined by and/or and checks the result of every possible assignment
+// against the expected "or of ands" semantics.
+func TestParserPrecedenceExhaustive(t *testing.T) {
+	assert := assert.New(t)
+	tags := []string{"a", "b", "c", "d"}
+	for numOperands := 1; numOperands <= len(tags); numOperands++ {
+		for notMask := 0; notMask < 1<<numOperands; notMask++ {
+			for opMask := 0; opMask < 1<<(numOperands-1); opMask++ {
+				var sb strings.Builder
+				for i := 0; i < numOperands; i++ {
+					if i > 0 {
+						if opMask&(1<<(i-1)) != 0 {
+							sb.WriteString(" and ")
+						} else {
+							sb.WriteString(" or ")
+						}
+					}
+					if notMask&(1<<i) != 0 {
+						sb.WriteString("not ")
+					}
+					sb.WriteString(`"` + tags[i] + `"`)
+				}
+				expStr := sb.String()
+
+				exp, err := NewParser(strings.NewReader(expStr)).Parse()
+				if !assert.Nil(err, expStr) {
+					continue
+				}
+
+				for valMask := 0; valMask < 1<<numOperands; valMask++ {
+					fieldPathByTag := make(map[string][]string)
+					for i := 0; i < numOperands; i++ {
+						if valMask&(1<<i) != 0 {
+							fieldPathByTag[tags[i]] = nil
+						}
+					}
+
+					expected := false
+					group := true
+					for i := 0; i < numOperands; i++ {
+						if i > 0 && opMask&(1<<(i-1)) == 0 {
+							expected = expected || group
+							group = true
+						}
+						operand := valMask&(1<<i) != 0
+						if notMask&(1<<i) != 0 {
+							operand = !operand
+						}
+						group = group && operand
+					}
+					expected = expected || group
+
+					res, err := exp.Solve(fieldPathByTag)
+					assert.Nil(err, expStr)
+					assert.Equal(expected, res, fmt.Sprintf("%s with %v", expStr, fieldPathByTag))
+				}
+			}
+		}
+	}
+}
+
+func TestParserPrecedenceErrors(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		expStr      string
+		expectedErr error
+		message     string
+	}{
+		{
+			expStr: `"a" and or "b"`,
+			expectedErr: &ParseError{
+				Pos:      Position{Offset: 8, Line: 1, Column: 9},
+				Token:    OR,
+				Lit:      "or",
+				Expected: operandTokens,
+				Msg:      "invalid expression: no left expression was found for OR",
+			},
+			message: "consecutive operators",
+		},
+		{
+			expStr: `"a" "b"`,
+			expectedErr: &ParseError{
+				Pos:      Position{Offset: 4, Line: 1, Column: 5},
+				Token:    TAG,
+				Lit:      "b",
+				Expected: []Token{AND, OR, EOF},
+				Msg:      "invalid expression: Unexpected token 'TAG' (b)",
+			},
+			message: "missing operator",
+		},
+		{
+			expStr: `"a" and ()`,
+			expectedErr: &ParseError{
+				Pos:      Position{Offset: 9, Line: 1, Column: 10},
+				Token:    CLPAR,
+				Lit:      ")",
+				Expected: operandTokens,
+				Msg:      "invalid expression: Unexpected token 'CLPAR' ())",
+			},
+			message: "empty parentheses",
+		},
+		{
+			expStr: `("a" or "b"`,
+			expectedErr: &ParseError{
+				Pos:      Position{Offset: 11, Line: 1, Column: 12},
+				Token:    EOF,
+				Lit:      "",
+				Expected: []Token{AND, OR, CLPAR},
+				Msg:      "invalid expression: Unexpected '('",
+			},
+			message: "unclosed parentheses",
+		},
+		{
+			expStr: `"a"))`,
+			expectedErr: &ParseError{
+				Pos:      Position{Offset: 3, Line: 1, Column: 4},
+				Token:    CLPAR,
+				Lit:      ")",
+				Expected: []Token{AND, OR, EOF},
+				Msg:      "invalid expression: unexpected EOF found. Extra closing parentheses: 2",
+			},
+			message: "extra closing parentheses",
+		},
+		{
+			expStr: `not and "a"`,
+			expectedErr: &ParseError{
+				Pos:      Position{Offset: 4, Line: 1, Column: 5},
+				Token:    AND,
+				Lit:      "and",
+				Expected: operandTokens,
+				Msg:      "invalid expression: Unexpected token 'AND' after NOT",
+			},
+			message: "operator after not",
+		},
+	}
+
+	for _, tc := range tests {
+		exp, err := NewParser(strings.NewReader(tc.expStr)).Parse()
+		assert.Equal(tc.expectedErr, err, tc.message)
+		assert.Nil(exp, tc.message)
+	}
+}
+
+func TestParserErrorPosition(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		expStr      string
+		leftToRight bool
+		expectedErr error
+		message     string
+	}{
+		{
+			expStr: "\"tag1\" and\n(\"tag2\" or\n)",
+			expectedErr: &ParseError{
+				Pos:      Position{Offset: 22, Line: 3, Column: 1},
+				Token:    CLPAR,
+				Lit:      ")",
+				Expected: operandTokens,
+				Msg:      "invalid expression: incomplete expression OR",
+			},
+			message: "multiline expression",
+		},
+		{
+			expStr: "\"tag1\"\n\tand \"tag2:field\\s\"",
+			expectedErr: &ParseError{
+				Pos:   Position{Offset: 24, Line: 2, Column: 18},
+				Token: ILLEGAL,
+				Lit:   "s",
+				Msg:   "fail to scan field: invalid escaped char s",
+			},
+			message: "scanner error",
+		},
+		{
+			expStr:      `"tag1" and not and`,
+			leftToRight: true,
+			expectedErr: &ParseError{
+				Pos:      Position{Offset: 15, Line: 1, Column: 16},
+				Token:    AND,
+				Lit:      "and",
+				Expected: []Token{TAG, TRUE, FALSE, ATLEAST, ANYOF, COUNT, SAMEFIELD, SAMEPARENT, RULE, OPPAR},
+				Msg:      "invalid expression: Unexpected token 'AND' after NOT",
+			},
+			message: "left to right operator after not",
+		},
+		{
+			expStr:      `"tag1" and ("tag2"`,
+			leftToRight: true,
+			expectedErr: &ParseError{
+				Pos:      Position{Offset: 18, Line: 1, Column: 19},
+				Token:    EOF,
+				Lit:      "",
+				Expected: []Token{CLPAR},
+				Msg:      "invalid expression: Unexpected '('",
+			},
+			message: "left to right unclosed parentheses",
+		},
+	}
+
+	for _, tc := range tests {
+		p := NewParser(strings.NewReader(tc.expStr))
+		p.SetLeftToRight(tc.leftToRight)
+		_, err := p.Parse()
+		assert.Equal(tc.expectedErr, err, tc.message)
+	}
+}
+
+func TestParserConstants(t *testing.T) {
+	assert := assert.New(t)
+	expected := &Expression{
+		Type: AND_EXPR,
+		LExpr: &Expression{
+			Type:  OR_EXPR,
+			LExpr: &Expression{Type: UNIT_EXPR, Tag: TagInfo{Name: "tag1"}},
+			RExpr: &Expression{Type: TRUE_EXPR},
+		},
+		RExpr: &Expression{
+			Type:  NOT_EXPR,
+			RExpr: &Expression{Type: FALSE_EXPR},
+		},
+	}
+
+	for _, leftToRight := range []bool{false, true} {
+		p := NewParser(strings.NewReader(`"tag1" or true and not false`))
+		if !leftToRight {
+			p = NewParser(strings.NewReader(`("tag1" or true) and not false`))
+		}
+		p.SetLeftToRight(leftToRight)
+		exp, err := p.Parse()
+		assert.Nil(err, fmt.Sprintf("left to right %t", leftToRight))
+		assert.Equal(expected, exp, fmt.Sprintf("left to right %t", leftToRight))
+	}
+}
+
+func TestParserQuantifiers(t *testing.T) {
+	assert := assert.New(t)
+	tag := func(name string) *Expression {
+		return &Expression{Type: UNIT_EXPR, Tag: TagInfo{Name: name}}
+	}
+	tests := []struct {
+		expStr      string
+		expectedExp *Expression
+		message     string
+	}{
+		{
+			expStr: `atleast(2, "a", "b" or "c", not "d")`,
+			expectedExp: &Expression{
+				Type:  ATLEAST_EXPR,
+				Count: 2,
+				Exprs: []*Expression{
+					tag("a"),
+					{Type: OR_EXPR, LExpr: tag("b"), RExpr: tag("c")},
+					{Type: NOT_EXPR, RExpr: tag("d")},
+				},
+			},
+			message: "atleast",
+		},
+		{
+			expStr: `ANYOF("a", ("b"))`,
+			expectedExp: &Expression{
+				Type:  ATLEAST_EXPR,
+				Count: 1,
+				Exprs: []*Expression{tag("a"), tag("b")},
+			},
+			message: "anyof",
+		},
+		{
+			expStr: `count("a:field1") >= 3 and not count("b") == 0`,
+			expectedExp: &Expression{
+				Type: AND_EXPR,
+				LExpr: &Expression{
+					Type:     COUNT_EXPR,
+					Tag:      TagInfo{Name: "a", FieldPath: "field1"},
+					Operator: GREATER_EQUAL_OP,
+					Count:    3,
+				},
+				RExpr: &Expression{
+					Type:  NOT_EXPR,
+					RExpr: &Expression{Type: COUNT_EXPR, Tag: TagInfo{Name: "b"}, Operator: EQUAL_OP},
+				},
+			},
+			message: "count",
+		},
+	}
+
+	for _, tc := range tests {
+		for _, leftToRight := range []bool{false, true} {
+			msg := fmt.Sprintf("%s left to right %t", tc.message, leftToRight)
+			p := NewParser(strings.NewReader(tc.expStr))
+			p.SetLeftToRight(leftToRight)
+			exp, err := p.Parse()
+			assert.Nil(err, msg)
+			assert.Equal(tc.expectedExp, exp, msg)
+		}
+	}
+
+	p := NewParser(strings.NewReader(`atleast(1, "a", count("b:field2") > 1)`))
+	_, err := p.Parse()
+	assert.Nil(err)
+	assert.ElementsMatch([]string{"a", "b"}, p.GetTags(), "parser tags")
+	assert.ElementsMatch([]string{"field2"}, p.GetFields(), "parser fields")
+}
+
+func TestParserQuantifierErrors(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		expStr      string
+		expectedErr error
+		message     string
+	}{
+		{
+			expStr: `atleast "a"`,
+			expectedErr: &ParseError{
+				Pos:      Position{Offset: 8, Line: 1, Column: 9},
+				Token:    TAG,
+				Lit:      "a",
+				Expected: []Token{OPPAR},
+				Msg:      "invalid expression: expected '(' after ATLEAST",
+			},
+			message: "missing open parentheses",
+		},
+		{
+			expStr: `atleast("a", "b")`,
+			expectedErr: &ParseError{
+				Pos:      Position{Offset: 8, Line: 1, Column: 9},
+				Token:    TAG,
+				Lit:      "a",
+				Expected: []Token{NUMBER},
+				Msg:      "invalid expression: expected the number of expressions of ATLEAST but found TAG",
+			},
+			message: "missing count",
+		},
+		{
+			expStr: `atleast(3, "a", "b")`,
+			expectedErr: &ParseError{
+				Pos:   Position{Offset: 8, Line: 1, Column: 9},
+				Token: NUMBER,
+				Lit:   "3",
+				Msg:   "invalid expression: ATLEAST count must be between 1 and the number of expressions (2)",
+			},
+			message: "count greater than the expressions",
+		},
+		{
+			expStr: `atleast(0, "a")`,
+			expectedErr: &ParseError{
+				Pos:   Position{Offset: 8, Line: 1, Column: 9},
+				Token: NUMBER,
+				Lit:   "0",
+				Msg:   "invalid expression: ATLEAST count must be between 1 and the number of expressions (1)",
+			},
+			message: "zero count",
+		},
+		{
+			expStr: `anyof("a" "b")`,
+			expectedErr: &ParseError{
+				Pos:      Position{Offset: 10, Line: 1, Column: 11},
+				Token:    TAG,
+				Lit:      "b",
+				Expected: []Token{AND, OR, COMMA, CLPAR},
+				Msg:      "invalid expression: Unexpected token 'TAG' (b) on ANYOF",
+			},
+			message: "missing comma",
+		},
+		{
+			expStr: `anyof("a",)`,
+			expectedErr: &ParseError{
+				Pos:      Position{Offset: 10, Line: 1, Column: 11},
+				Token:    CLPAR,
+				Lit:      ")",
+				Expected: operandTokens,
+				Msg:      "invalid expression: Unexpected token 'CLPAR' ())",
+			},
+			message: "missing expression",
+		},
+		{
+			expStr: `count("a" >= 1`,
+			expectedErr: &ParseError{
+				Pos:      Position{Offset: 10, Line: 1, Column: 11},
+				Token:    GTE,
+				Lit:      ">=",
+				Expected: []Token{CLPAR},
+				Msg:      "invalid expression: expected ')' after the tag of COUNT",
+			},
+			message: "count missing close parentheses",
+		},
+		{
+			expStr: `count("a") 1`,
+			expectedErr: &ParseError{
+				Pos:      Position{Offset: 11, Line: 1, Column: 12},
+				Token:    NUMBER,
+				Lit:      "1",
+				Expected: compareTokens,
+				Msg:      "invalid expression: expected a comparison after COUNT but found NUMBER",
+			},
+			message: "count missing comparison",
+		},
+		{
+			expStr: `count("a") > "b"`,
+			expectedErr: &ParseError{
+				Pos:      Position{Offset: 13, Line: 1, Column: 14},
+				Token:    TAG,
+				Lit:      "b",
+				Expected: []Token{NUMBER},
+				Msg:      "invalid expression: expected a number after the comparison of COUNT but found TAG",
+			},
+			message: "count missing number",
+		},
+		{
+			expStr: `count("a") > 99999999999999999999`,
+			expectedErr: &ParseError{
+				Pos:   Position{Offset: 13, Line: 1, Column: 14},
+				Token: NUMBER,
+				Lit:   "99999999999999999999",
+				Msg:   "invalid expression: invalid number 99999999999999999999",
+			},
+			message: "count number out of range",
+		},
+	}
+
+	for _, tc := range tests {
+		_, err := NewParser(strings.NewReader(tc.expStr)).Parse()
+		assert.Equal(tc.expectedErr, err, tc.message)
+	}
+}
+
+func TestParserColocation(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		expStr      string
+		expectedExp *Expression
+		expectedErr error
+		message     string
+	}{
+		{
+			expStr: `samefield("a", "b:customers")`,
+			expectedExp: &Expression{
+				Type: SAMEPARENT_EXPR,
+				Exprs: []*Expression{
+					{Type: UNIT_EXPR, Tag: TagInfo{Name: "a"}},
+					{Type: UNIT_EXPR, Tag: TagInfo{Name: "b", FieldPath: "customers"}},
+				},
+			},
+			message: "samefield",
+		},
+		{
+			expStr: `not SameParent("a", "b", "c", 2)`,
+			expectedExp: &Expression{
+				Type: NOT_EXPR,
+				RExpr: &Expression{
+					Type:  SAMEPARENT_EXPR,
+					Depth: 2,
+					Exprs: []*Expression{
+						{Type: UNIT_EXPR, Tag: TagInfo{Name: "a"}},
+						{Type: UNIT_EXPR, Tag: TagInfo{Name: "b"}},
+						{Type: UNIT_EXPR, Tag: TagInfo{Name: "c"}},
+					},
+				},
+			},
+			message: "sameparent",
+		},
+		{
+			expStr: `samefield("a")`,
+			expectedErr: &ParseError{
+				Pos:      Position{Offset: 13, Line: 1, Column: 14},
+				Token:    CLPAR,
+				Lit:      ")",
+				Expected: []Token{COMMA},
+				Msg:      "invalid expression: SAMEFIELD needs at least 2 tags",
+			},
+			message: "samefield with one tag",
+		},
+		{
+			expStr: `samefield("a", "b", 1)`,
+			expectedErr: &ParseError{
+				Pos:      Position{Offset: 20, Line: 1, Column: 21},
+				Token:    NUMBER,
+				Lit:      "1",
+				Expected: []Token{TAG},
+				Msg:      "invalid expression: Expecting TAG but found NUMBER",
+			},
+			message: "samefield with depth",
+		},
+		{
+			expStr: `sameparent("a", "b")`,
+			expectedErr: &ParseError{
+				Pos:      Position{Offset: 19, Line: 1, Column: 20},
+				Token:    CLPAR,
+				Lit:      ")",
+				Expected: []Token{COMMA},
+				Msg:      "invalid expression: expected the depth of SAMEPARENT",
+			},
+			message: "sameparent without depth",
+		},
+		{
+			expStr: `sameparent("a", "b", 1, "c")`,
+			expectedErr: &ParseError{
+				Pos:      Position{Offset: 22, Line: 1, Column: 23},
+				Token:    COMMA,
+				Lit:      ",",
+				Expected: []Token{CLPAR},
+				Msg:      "invalid expression: expected ')' after the depth of SAMEPARENT",
+			},
+			message: "sameparent with depth before the tags",
+		},
+		{
+			expStr: `samefield("a" and "b")`,
+			expectedErr: &ParseError{
+				Pos:      Position{Offset: 14, Line: 1, Column: 15},
+				Token:    AND,
+				Lit:      "and",
+				Expected: []Token{COMMA, CLPAR},
+				Msg:      "invalid expression: Unexpected token 'AND' (and) on SAMEFIELD",
+			},
+			message: "samefield with expression",
+		},
+	}
+
+	for _, tc := range tests {
+		for _, leftToRight := range []bool{false, true} {
+			msg := fmt.Sprintf("%s left to right %t", tc.message, leftToRight)
+			p := NewParser(strings.NewReader(tc.expStr))
+			p.SetLeftToRight(leftToRight)
+			exp, err := p.Parse()
+			assert.Equal(tc.expectedErr, err, msg)
+			if tc.expectedErr == nil {
+				assert.Equal(tc.expectedExp, exp, msg)
+			}
+		}
+	}
+}
+
+func TestParserRuleReference(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		expStr      string
+		expectedExp *Expression
+		expectedErr error
+		message     string
+	}{
+		{
+			expStr:      `rule("rule 1")`,
+			expectedExp: &Expression{Type: RULE_EXPR, RuleName: "rule 1"},
+			message:     "rule reference",
+		},
+		{
+			expStr: `"a" and not RULE("r\:1")`,
+			expectedExp: &Expression{
+				Type:  AND_EXPR,
+				LExpr: &Expression{Type: UNIT_EXPR, Tag: TagInfo{Name: "a"}},
+				RExpr: &Expression{
+					Type:  NOT_EXPR,
+					RExpr: &Expression{Type: RULE_EXPR, RuleName: "r:1"},
+				},
+			},
+			message: "negated rule reference with escaped name",
+		},
+		{
+			expStr: `rule "a"`,
+			expectedErr: &ParseError{
+				Pos:      Position{Offset: 5, Line: 1, Column: 6},
+				Token:    TAG,
+				Lit:      "a",
+				Expected: []Token{OPPAR},
+				Msg:      "invalid expression: expected '(' after RULE",
+			},
+			message: "rule without parentheses",
+		},
+		{
+			expStr: `rule("a:field")`,
+			expectedErr: &ParseError{
+				Pos:   Position{Offset: 7, Line: 1, Column: 8},
+				Token: FIELD_PATH,
+				Lit:   "field",
+				Msg:   "invalid expression: rule reference can not have a field path",
+			},
+			message: "rule with field path",
+		},
+		{
+			expStr: `rule("a", "b")`,
+			expectedErr: &ParseError{
+				Pos:      Position{Offset: 8, Line: 1, Column: 9},
+				Token:    COMMA,
+				Lit:      ",",
+				Expected: []Token{CLPAR},
+				Msg:      "invalid expression: expected ')' after the name of the rule",
+			},
+			message: "rule with many names",
+		},
+	}
+
+	for _, tc := range tests {
+		for _, leftToRight := range []bool{false, true} {
+			msg := fmt.Sprintf("%s left to right %t", tc.message, leftToRight)
+			p := NewParser(strings.NewReader(tc.expStr))
+			p.SetLeftToRight(leftToRight)
+			exp, err := p.Parse()
+			assert.Equal(tc.expectedErr, err, msg)
+			if tc.expectedErr != nil {
+				continue
+			}
+			assert.Equal(tc.expectedExp, exp, msg)
+
+			roundTrip, err := NewParser(strings.NewReader(exp.Format())).Parse()
+			assert.Nil(err, msg+" round trip")
+			assert.Equal(exp, roundTrip, msg+" round trip")
+		}
+	}
+}
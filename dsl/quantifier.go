@@ -0,0 +1,176 @@
+package dsl
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// CompareOp is the operator used to compare the number of field paths of a COUNT expression.
+type CompareOp int
+
+const (
+	UNSET_OP CompareOp = iota
+	EQUAL_OP
+	NOT_EQUAL_OP
+	LESS_OP
+	LESS_EQUAL_OP
+	GREATER_OP
+	GREATER_EQUAL_OP
+)
+
+// GetName returns the symbol of the CompareOp used on the DSL
+func (op CompareOp) GetName() string {
+	switch op {
+	case UNSET_OP:
+		return "UNSET"
+	case EQUAL_OP:
+		return "=="
+	case NOT_EQUAL_OP:
+		return "!="
+	case LESS_OP:
+		return "<"
+	case LESS_EQUAL_OP:
+		return "<="
+	case GREATER_OP:
+		return ">"
+	case GREATER_EQUAL_OP:
+		return ">="
+	default:
+		return "UNEXPECTED"
+	}
+}
+
+// String returns the symbol of the CompareOp
+func (op CompareOp) String() string {
+	return op.GetName()
+}
+
+// Compare returns the result of the comparison "value op n".
+func (op CompareOp) Compare(value int, n int) bool {
+	switch op {
+	case EQUAL_OP:
+		return value == n
+	case NOT_EQUAL_OP:
+		return value != n
+	case LESS_OP:
+		return value < n
+	case LESS_EQUAL_OP:
+		return value <= n
+	case GREATER_OP:
+		return value > n
+	case GREATER_EQUAL_OP:
+		return value >= n
+	default:
+		return false
+	}
+}
+
+// MarshalJSON returns the symbol of the CompareOp as a JSON string.
+func (op CompareOp) MarshalJSON() ([]byte, error) {
+	return json.Marshal(op.GetName())
+}
+
+// UnmarshalJSON sets the CompareOp from its symbol.
+func (op *CompareOp) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	return op.setName(name)
+}
+
+// MarshalYAML returns the symbol of the CompareOp.
+func (op CompareOp) MarshalYAML() (interface{}, error) {
+	return op.GetName(), nil
+}
+
+// UnmarshalYAML sets the CompareOp from its symbol.
+func (op *CompareOp) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err != nil {
+		return err
+	}
+	return op.setName(name)
+}
+
+// setName sets the CompareOp that has the given symbol.
+func (op *CompareOp) setName(name string) error {
+	for o := UNSET_OP; o.GetName() != "UNEXPECTED"; o++ {
+		if o.GetName() == name {
+			*op = o
+			return nil
+		}
+	}
+	return fmt.Errorf("unexpected compare operator %q", name)
+}
+
+// compareOpByToken returns the CompareOp of a comparison token.
+// ok is false if the token is not a comparison.
+func compareOpByToken(tok Token) (op CompareOp, ok bool) {
+	switch tok {
+	case EQ:
+		return EQUAL_OP, true
+	case NEQ:
+		return NOT_EQUAL_OP, true
+	case LT:
+		return LESS_OP, true
+	case LTE:
+		return LESS_EQUAL_OP, true
+	case GT:
+		return GREATER_OP, true
+	case GTE:
+		return GREATER_EQUAL_OP, true
+	default:
+		return UNSET_OP, false
+	}
+}
+
+// matchedFieldPaths returns the unique field paths where the tag was found
+// that match the field path of the tag, in the order that they are found.
+func matchedFieldPaths(tag TagInfo, fieldPaths []string, opts SolveOptions) (matched []string) {
+	seen := make(map[string]struct{}, len(fieldPaths))
+	for _, fieldPath := range fieldPaths {
+		if _, ok := seen[fieldPath]; ok {
+			continue
+		}
+		seen[fieldPath] = struct{}{}
+		if tag.FieldPath == "" || opts.matchFieldPath(tag.FieldPath, fieldPath) {
+			matched = append(matched, fieldPath)
+		}
+	}
+	return
+}
+
+// countFieldPaths returns the number of unique field paths where the tag of the COUNT
+// expression was found that match its field path. A tag that was found without field
+// paths (eg: on text without fields) is counted once if the COUNT has no field path.
+func (exp *Expression) countFieldPaths(fieldPathByTag map[string][]string, opts SolveOptions) int {
+	fieldPaths, found := fieldPathByTag[exp.Tag.Name]
+	if found && len(fieldPaths) == 0 && exp.Tag.FieldPath == "" {
+		return 1
+	}
+	return len(matchedFieldPaths(exp.Tag, fieldPaths, opts))
+}
+
+// solveAtLeast returns true if at least exp.Count of the operands are true.
+// The operands are solved until the result is known.
+func (exp *Expression) solveAtLeast(fieldPathByTag map[string][]string, opts SolveOptions) (bool, error) {
+	trueCount := 0
+	for i, operand := range exp.Exprs {
+		if trueCount >= exp.Count {
+			return true, nil
+		}
+		// the remaining operands are not enough to reach the count
+		if trueCount+len(exp.Exprs)-i < exp.Count {
+			return false, nil
+		}
+		eval, err := operand.solve(fieldPathByTag, opts)
+		if err != nil {
+			return false, err
+		}
+		if eval {
+			trueCount++
+		}
+	}
+	return trueCount >= exp.Count, nil
+}
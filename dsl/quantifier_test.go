@@ -0,0 +1,49 @@
+package dsl
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestCompareOp(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		op       CompareOp
+		name     string
+		expected []bool // results of comparing 1, 2 and 3 with 2
+	}{
+		{op: EQUAL_OP, name: "==", expected: []bool{false, true, false}},
+		{op: NOT_EQUAL_OP, name: "!=", expected: []bool{true, false, true}},
+		{op: LESS_OP, name: "<", expected: []bool{true, false, false}},
+		{op: LESS_EQUAL_OP, name: "<=", expected: []bool{true, true, false}},
+		{op: GREATER_OP, name: ">", expected: []bool{false, false, true}},
+		{op: GREATER_EQUAL_OP, name: ">=", expected: []bool{false, true, true}},
+		{op: UNSET_OP, name: "UNSET", expected: []bool{false, false, false}},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(tc.name, tc.op.String(), tc.name)
+		for i, value := range []int{1, 2, 3} {
+			assert.Equal(tc.expected[i], tc.op.Compare(value, 2), fmt.Sprintf("%d %s 2", value, tc.name))
+		}
+
+		data, err := json.Marshal(tc.op)
+		assert.Nil(err, tc.name)
+		var jsonOp CompareOp
+		assert.Nil(json.Unmarshal(data, &jsonOp), tc.name)
+		assert.Equal(tc.op, jsonOp, tc.name+" json")
+
+		data, err = yaml.Marshal(tc.op)
+		assert.Nil(err, tc.name)
+		var yamlOp CompareOp
+		assert.Nil(yaml.Unmarshal(data, &yamlOp), tc.name)
+		assert.Equal(tc.op, yamlOp, tc.name+" yaml")
+	}
+
+	var op CompareOp
+	assert.Equal(fmt.Errorf("unexpected compare operator \"=\""), json.Unmarshal([]byte(`"="`), &op), "unknown operator")
+}
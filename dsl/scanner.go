@@ -30,8 +30,39 @@ const (
 	AND // 'and' or 'AND'
 	OR  // 'or' or 'OR'
 	NOT // 'not' or 'NOT'
+
+	// Constants
+	TRUE  // 'true' or 'TRUE'
+	FALSE // 'false' or 'FALSE'
+
+	// Quantifiers
+	ATLEAST // 'atleast' or 'ATLEAST'
+	ANYOF   // 'anyof' or 'ANYOF'
+	COUNT   // 'count' or 'COUNT'
+	NUMBER  // 123
+	COMMA   // ,
+
+	// Comparisons
+	EQ  // ==
+	NEQ // !=
+	LT  // <
+	LTE // <=
+	GT  // >
+	GTE // >=
+
+	// Co-location
+	SAMEFIELD  // 'samefield' or 'SAMEFIELD'
+	SAMEPARENT // 'sameparent' or 'SAMEPARENT'
+
+	// Rule reference
+	RULE // 'rule' or 'RULE'
 )
 
+// String returns a readable name for the Token
+func (tok Token) String() string {
+	return tok.getName()
+}
+
 // getName returns a readable name for the Token
 func (tok Token) getName() string {
 	switch tok {
@@ -57,6 +88,38 @@ func (tok Token) getName() string {
 		return "OR"
 	case NOT:
 		return "NOT"
+	case TRUE:
+		return "TRUE"
+	case FALSE:
+		return "FALSE"
+	case ATLEAST:
+		return "ATLEAST"
+	case ANYOF:
+		return "ANYOF"
+	case COUNT:
+		return "COUNT"
+	case NUMBER:
+		return "NUMBER"
+	case COMMA:
+		return "COMMA"
+	case EQ:
+		return "EQ"
+	case NEQ:
+		return "NEQ"
+	case LT:
+		return "LT"
+	case LTE:
+		return "LTE"
+	case GT:
+		return "GT"
+	case GTE:
+		return "GTE"
+	case SAMEFIELD:
+		return "SAMEFIELD"
+	case SAMEPARENT:
+		return "SAMEPARENT"
+	case RULE:
+		return "RULE"
 	default:
 		return "UNEXPECTED"
 	}
@@ -64,16 +127,27 @@ func (tok Token) getName() string {
 
 // Scanner represents a lexical scanner.
 type Scanner struct {
-	r *bufio.Reader
+	r      *bufio.Reader
+	pos    Position // position of the next rune
+	prev   Position // position before the last read, used by unread
+	tokPos Position // position of the last scanned token
 }
 
 // NewScanner returns a new instance of Scanner.
 func NewScanner(r io.Reader) *Scanner {
-	return &Scanner{r: bufio.NewReader(r)}
+	start := Position{Offset: 0, Line: 1, Column: 1}
+	return &Scanner{r: bufio.NewReader(r), pos: start, prev: start, tokPos: start}
+}
+
+// Pos returns the position of the first rune of the last scanned token.
+func (s *Scanner) Pos() Position {
+	return s.tokPos
 }
 
 // Scan returns the next token and literal value.
+// If the token can not be scanned the error is a *ParseError.
 func (s *Scanner) Scan() (tok Token, lit string, err error) {
+	s.tokPos = s.pos
 	// Read the next rune.
 	ch := s.read()
 
@@ -81,6 +155,8 @@ func (s *Scanner) Scan() (tok Token, lit string, err error) {
 	// If we see a letter then consume as an operator.
 	// If we see a '"' consume as a TAG.
 	// If we see a '(' or ')' returns OPPAR or CLPAR respectively
+	// If we see a digit consume as a NUMBER.
+	// If we see a '=', '!', '<' or '>' consume as a comparison.
 	switch {
 	case isWhitespace(ch):
 		s.unread()
@@ -98,11 +174,19 @@ func (s *Scanner) Scan() (tok Token, lit string, err error) {
 		return OPPAR, "(", nil
 	case ch == ')':
 		return CLPAR, ")", nil
+	case ch == ',':
+		return COMMA, ",", nil
+	case isDigit(ch):
+		s.unread()
+		return s.scanNumber()
+	case ch == '=' || ch == '!' || ch == '<' || ch == '>':
+		s.unread()
+		return s.scanComparison()
 	case ch == eof:
 		return EOF, "", nil
 	}
 
-	return ILLEGAL, "", fmt.Errorf("illegal char was found %c", ch)
+	return ILLEGAL, "", s.errorf(s.tokPos, string(ch), "illegal char was found %c", ch)
 }
 
 // scanWhitespace consumes the current rune and all contiguous whitespace.
@@ -132,7 +216,7 @@ func (s *Scanner) scanOperators() (tok Token, lit string, err error) {
 	// Create a buffer and read the current character into it.
 	ch := s.read()
 	if !isLetter(ch) {
-		return ILLEGAL, "", fmt.Errorf("fail to scan operator: expected letter but found %c", ch)
+		return ILLEGAL, "", s.errorf(s.tokPos, string(ch), "fail to scan operator: expected letter but found %c", ch)
 	}
 	var buf bytes.Buffer
 
@@ -151,7 +235,7 @@ func (s *Scanner) scanOperators() (tok Token, lit string, err error) {
 		}
 	}
 
-	// If the string matches a operator then return that operator.
+	// If the string matches a operator or a constant then return it.
 	// Otherwise return an error.
 	lit = buf.String()
 	switch strings.ToUpper(lit) {
@@ -161,36 +245,103 @@ func (s *Scanner) scanOperators() (tok Token, lit string, err error) {
 		tok = OR
 	case "NOT":
 		tok = NOT
+	case "TRUE":
+		tok = TRUE
+	case "FALSE":
+		tok = FALSE
+	case "ATLEAST":
+		tok = ATLEAST
+	case "ANYOF":
+		tok = ANYOF
+	case "COUNT":
+		tok = COUNT
+	case "SAMEFIELD":
+		tok = SAMEFIELD
+	case "SAMEPARENT":
+		tok = SAMEPARENT
+	case "RULE":
+		tok = RULE
 	default:
-		return ILLEGAL, "", fmt.Errorf("failed to scan operator: unexpected operator '%s' found", lit)
+		return ILLEGAL, "", s.errorf(s.tokPos, lit, "failed to scan operator: unexpected operator '%s' found", lit)
 	}
 
 	return
 }
 
+// scanNumber consumes the current rune and all contiguous digits.
+func (s *Scanner) scanNumber() (tok Token, lit string, err error) {
+	var buf bytes.Buffer
+	for {
+		if ch := s.read(); ch == eof {
+			break
+		} else if !isDigit(ch) {
+			s.unread()
+			break
+		} else {
+			_, _ = buf.WriteRune(ch)
+		}
+	}
+
+	return NUMBER, buf.String(), nil
+}
+
+// scanComparison consumes the comparison operator that starts on the current rune.
+// '=' and '!' must be followed by '=' and '<' and '>' can be followed by '='.
+func (s *Scanner) scanComparison() (tok Token, lit string, err error) {
+	ch := s.read()
+	next := s.read()
+	if next == '=' {
+		lit = string([]rune{ch, next})
+		switch ch {
+		case '=':
+			return EQ, lit, nil
+		case '!':
+			return NEQ, lit, nil
+		case '<':
+			return LTE, lit, nil
+		default:
+			return GTE, lit, nil
+		}
+	}
+	if next != eof {
+		s.unread()
+	}
+
+	switch ch {
+	case '<':
+		return LT, "<", nil
+	case '>':
+		return GT, ">", nil
+	default:
+		return ILLEGAL, "", s.errorf(s.tokPos, string(ch), "fail to scan comparison: expected '=' after %c", ch)
+	}
+}
+
 // scanTag scans the tag and scape needed characters
 // If a invalid scape is used an error will be returned and if EOF is found
 // before a '"' returns an error as well.
 func (s *Scanner) scanTag() (tok Token, lit string, err error) {
 	ch := s.read()
 	if ch != '"' {
-		return ILLEGAL, "", fmt.Errorf("fail to scan tag: expected \" but found %c", ch)
+		return ILLEGAL, "", s.errorf(s.tokPos, string(ch), "fail to scan tag: expected \" but found %c", ch)
 	}
 	var buf bytes.Buffer
 
 Loop:
 	for {
+		pos := s.pos
 		ch := s.read()
 		switch ch {
 		case eof:
-			return ILLEGAL, "", fmt.Errorf("fail to scan tag: expected ':' but found EOF")
+			return ILLEGAL, "", s.errorf(pos, "", "fail to scan tag: expected ':' but found EOF")
 		case '\\':
+			pos = s.pos
 			scapedCh := s.read()
 			switch scapedCh {
 			case '\\', '"', ':':
 				_, _ = buf.WriteRune(scapedCh)
 			default:
-				return ILLEGAL, "", fmt.Errorf("fail to scan tag: invalid escaped char %c", scapedCh)
+				return ILLEGAL, "", s.errorf(pos, string(scapedCh), "fail to scan tag: invalid escaped char %c", scapedCh)
 			}
 		case ':':
 			s.unread()
@@ -208,26 +359,33 @@ Loop:
 
 // scanFieldPath scans the tag and scape needed characters
 // If a invalid scape is used an error will be returned and if EOF is found
-// before a '"' returns an error as well.
+// before a '"' returns an error as well. On regex field paths (starting
+// with '/') the escapes other than '\\' and '"' are kept as they are.
 func (s *Scanner) scanFieldPath() (tok Token, lit string, err error) {
 	ch := s.read()
 	if ch != ':' {
-		return ILLEGAL, "", fmt.Errorf("fail to scan field: expected ':' but found %c", ch)
+		return ILLEGAL, "", s.errorf(s.tokPos, string(ch), "fail to scan field: expected ':' but found %c", ch)
 	}
 	var buf bytes.Buffer
 Loop:
 	for {
+		pos := s.pos
 		ch := s.read()
 		switch ch {
 		case eof:
-			return ILLEGAL, "", fmt.Errorf("fail to scan field: expected '\"' but found EOF")
+			return ILLEGAL, "", s.errorf(pos, "", "fail to scan field: expected '\"' but found EOF")
 		case '\\':
+			pos = s.pos
 			scapedCh := s.read()
-			switch scapedCh {
-			case '\\', '"':
+			switch {
+			case scapedCh == '\\' || scapedCh == '"':
+				_, _ = buf.WriteRune(scapedCh)
+			case scapedCh != eof && strings.HasPrefix(strings.TrimLeft(buf.String(), " "), "/"):
+				// the other escapes of regex field paths are kept for the regex
+				_, _ = buf.WriteRune('\\')
 				_, _ = buf.WriteRune(scapedCh)
 			default:
-				return ILLEGAL, "", fmt.Errorf("fail to scan field: invalid escaped char %c", scapedCh)
+				return ILLEGAL, "", s.errorf(pos, string(scapedCh), "fail to scan field: invalid escaped char %c", scapedCh)
 			}
 		case '"':
 			break Loop
@@ -240,18 +398,40 @@ Loop:
 	return
 }
 
-// read reads the next rune from the buffered reader.
+// read reads the next rune from the buffered reader and updates the position.
 // Returns the rune(0) if an error occurs (or io.EOF is returned).
 func (s *Scanner) read() rune {
+	s.prev = s.pos
 	ch, _, err := s.r.ReadRune()
 	if err != nil {
 		return eof
 	}
+
+	s.pos.Offset++
+	if ch == '\n' {
+		s.pos.Line++
+		s.pos.Column = 1
+	} else {
+		s.pos.Column++
+	}
 	return ch
 }
 
 // unread places the previously read rune back on the reader.
-func (s *Scanner) unread() { _ = s.r.UnreadRune() }
+func (s *Scanner) unread() {
+	s.pos = s.prev
+	_ = s.r.UnreadRune()
+}
+
+// errorf returns a ParseError for the literal at the given position that could not be scanned.
+func (s *Scanner) errorf(pos Position, lit string, format string, a ...interface{}) *ParseError {
+	return &ParseError{
+		Pos:   pos,
+		Token: ILLEGAL,
+		Lit:   lit,
+		Msg:   fmt.Sprintf(format, a...),
+	}
+}
 
 // isWhitespace returns true if the rune is a space, tab, or newline.
 func isWhitespace(ch rune) bool { return ch == ' ' || ch == '\t' || ch == '\n' }
@@ -259,5 +439,8 @@ func isWhitespace(ch rune) bool { return ch == ' ' || ch == '\t' || ch == '\n' }
 // isLetter returns true if the rune is a letter.
 func isLetter(ch rune) bool { return (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') }
 
+// isDigit returns true if the rune is a digit.
+func isDigit(ch rune) bool { return ch >= '0' && ch <= '9' }
+
 // eof represents a marker rune for the end of the reader.
 var eof = rune(0)
@@ -1,7 +1,6 @@
 package dsl
 
 import (
-	"fmt"
 	"strings"
 	"testing"
 
@@ -40,13 +39,86 @@ func TestScanner(t *testing.T) {
 			},
 			message: "all tokens",
 		},
+		{
+			expStr: `true FALSE`,
+			expected: []expectedAtScan{
+				{Tok: TRUE, Lit: "true", Err: nil},
+				{Tok: WS, Lit: " ", Err: nil},
+				{Tok: FALSE, Lit: "FALSE", Err: nil},
+				{Tok: EOF, Lit: "", Err: nil},
+			},
+			message: "constants",
+		},
+		{
+			expStr: `atleast(2,"a") AnyOf count==0!=10<1<=2>3>=45`,
+			expected: []expectedAtScan{
+				{Tok: ATLEAST, Lit: "atleast", Err: nil},
+				{Tok: OPPAR, Lit: "(", Err: nil},
+				{Tok: NUMBER, Lit: "2", Err: nil},
+				{Tok: COMMA, Lit: ",", Err: nil},
+				{Tok: TAG, Lit: "a", Err: nil},
+				{Tok: CLPAR, Lit: ")", Err: nil},
+				{Tok: WS, Lit: " ", Err: nil},
+				{Tok: ANYOF, Lit: "AnyOf", Err: nil},
+				{Tok: WS, Lit: " ", Err: nil},
+				{Tok: COUNT, Lit: "count", Err: nil},
+				{Tok: EQ, Lit: "==", Err: nil},
+				{Tok: NUMBER, Lit: "0", Err: nil},
+				{Tok: NEQ, Lit: "!=", Err: nil},
+				{Tok: NUMBER, Lit: "10", Err: nil},
+				{Tok: LT, Lit: "<", Err: nil},
+				{Tok: NUMBER, Lit: "1", Err: nil},
+				{Tok: LTE, Lit: "<=", Err: nil},
+				{Tok: NUMBER, Lit: "2", Err: nil},
+				{Tok: GT, Lit: ">", Err: nil},
+				{Tok: NUMBER, Lit: "3", Err: nil},
+				{Tok: GTE, Lit: ">=", Err: nil},
+				{Tok: NUMBER, Lit: "45", Err: nil},
+				{Tok: EOF, Lit: "", Err: nil},
+			},
+			message: "quantifiers and comparisons",
+		},
+		{
+			expStr: `Rule("rule 1")`,
+			expected: []expectedAtScan{
+				{Tok: RULE, Lit: "Rule", Err: nil},
+				{Tok: OPPAR, Lit: "(", Err: nil},
+				{Tok: TAG, Lit: "rule 1", Err: nil},
+				{Tok: CLPAR, Lit: ")", Err: nil},
+				{Tok: EOF, Lit: "", Err: nil},
+			},
+			message: "rule reference",
+		},
+		{
+			expStr: `count = 1`,
+			expected: []expectedAtScan{
+				{Tok: COUNT, Lit: "count", Err: nil},
+				{Tok: WS, Lit: " ", Err: nil},
+				{
+					Tok: ILLEGAL,
+					Lit: "",
+					Err: &ParseError{
+						Pos:   Position{Offset: 6, Line: 1, Column: 7},
+						Token: ILLEGAL,
+						Lit:   "=",
+						Msg:   "fail to scan comparison: expected '=' after =",
+					},
+				},
+			},
+			message: "invalid comparison",
+		},
 		{
 			expStr: `invalidOne`,
 			expected: []expectedAtScan{
 				{
 					Tok: ILLEGAL,
 					Lit: "",
-					Err: fmt.Errorf("failed to scan operator: unexpected operator 'invalidOne' found"),
+					Err: &ParseError{
+						Pos:   Position{Offset: 0, Line: 1, Column: 1},
+						Token: ILLEGAL,
+						Lit:   "invalidOne",
+						Msg:   "failed to scan operator: unexpected operator 'invalidOne' found",
+					},
 				},
 			},
 			message: "invalid operator token",
@@ -57,7 +129,12 @@ func TestScanner(t *testing.T) {
 				{
 					Tok: ILLEGAL,
 					Lit: "",
-					Err: fmt.Errorf("fail to scan tag: expected ':' but found EOF"),
+					Err: &ParseError{
+						Pos:   Position{Offset: 12, Line: 1, Column: 13},
+						Token: ILLEGAL,
+						Lit:   "",
+						Msg:   "fail to scan tag: expected ':' but found EOF",
+					},
 				},
 			},
 			message: "invalid tag token",
@@ -85,7 +162,12 @@ func TestScanner(t *testing.T) {
 				{
 					Tok: ILLEGAL,
 					Lit: "",
-					Err: fmt.Errorf("fail to scan tag: invalid escaped char s"),
+					Err: &ParseError{
+						Pos:   Position{Offset: 6, Line: 1, Column: 7},
+						Token: ILLEGAL,
+						Lit:   "s",
+						Msg:   "fail to scan tag: invalid escaped char s",
+					},
 				},
 				{Tok: EOF, Lit: "", Err: nil},
 			},
@@ -93,12 +175,17 @@ func TestScanner(t *testing.T) {
 		},
 
 		{
-			expStr: `123`,
+			expStr: `#123`,
 			expected: []expectedAtScan{
 				{
 					Tok: ILLEGAL,
 					Lit: "",
-					Err: fmt.Errorf("illegal char was found 1"),
+					Err: &ParseError{
+						Pos:   Position{Offset: 0, Line: 1, Column: 1},
+						Token: ILLEGAL,
+						Lit:   "#",
+						Msg:   "illegal char was found #",
+					},
 				},
 			},
 			message: "invalid operator",
@@ -129,3 +216,31 @@ func TestScanner(t *testing.T) {
 		}
 	}
 }
+
+func TestScannerPos(t *testing.T) {
+	assert := assert.New(t)
+	scanner := NewScanner(strings.NewReader("\"tag1\" and\n\tnot (\"tag2:field\")"))
+	expected := []struct {
+		tok Token
+		pos Position
+	}{
+		{tok: TAG, pos: Position{Offset: 0, Line: 1, Column: 1}},
+		{tok: WS, pos: Position{Offset: 6, Line: 1, Column: 7}},
+		{tok: AND, pos: Position{Offset: 7, Line: 1, Column: 8}},
+		{tok: WS, pos: Position{Offset: 10, Line: 1, Column: 11}},
+		{tok: NOT, pos: Position{Offset: 12, Line: 2, Column: 2}},
+		{tok: WS, pos: Position{Offset: 15, Line: 2, Column: 5}},
+		{tok: OPPAR, pos: Position{Offset: 16, Line: 2, Column: 6}},
+		{tok: TAG, pos: Position{Offset: 17, Line: 2, Column: 7}},
+		{tok: FIELD_PATH, pos: Position{Offset: 22, Line: 2, Column: 12}},
+		{tok: CLPAR, pos: Position{Offset: 29, Line: 2, Column: 19}},
+		{tok: EOF, pos: Position{Offset: 30, Line: 2, Column: 20}},
+	}
+
+	for _, exp := range expected {
+		tok, _, err := scanner.Scan()
+		assert.Nil(err, exp.tok.String())
+		assert.Equal(exp.tok, tok, exp.tok.String())
+		assert.Equal(exp.pos, scanner.Pos(), exp.tok.String())
+	}
+}
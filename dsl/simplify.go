@@ -0,0 +1,151 @@
+package dsl
+
+// Simplify returns an expression equivalent to exp (Solve gives the same result
+// for any tags) without redundant logic. The given expression is not changed.
+// The rules applied are:
+//   - double negation: not not "a" => "a"
+//   - flattening: ("a" or "b") or ("c" or "d") => "a" or "b" or "c" or "d"
+//   - idempotence: "a" and "b" and "a" => "a" and "b"
+//   - complement: "a" and not "a" => false, "a" or not "a" => true
+//   - constant folding: "a" and true => "a", "a" and false => false, not true => false
+//   - quantifiers: atleast(2, "a", true, false) => "a", atleast(1, "a", "b") => "a" or "b",
+//     atleast(2, "a", "b") => "a" and "b"
+//
+// Returns an error if the expression is not valid (see Validate).
+func Simplify(exp *Expression) (*Expression, error) {
+	if err := exp.Validate(); err != nil {
+		return nil, err
+	}
+	return simplify(exp), nil
+}
+
+// simplify implements Simplify for a valid expression.
+func simplify(exp *Expression) *Expression {
+	switch exp.Type {
+	case NOT_EXPR:
+		operand := simplify(exp.RExpr)
+		switch operand.Type {
+		case NOT_EXPR:
+			return operand.RExpr
+		case TRUE_EXPR:
+			return &Expression{Type: FALSE_EXPR}
+		case FALSE_EXPR:
+			return &Expression{Type: TRUE_EXPR}
+		default:
+			return &Expression{Type: NOT_EXPR, RExpr: operand}
+		}
+
+	case AND_EXPR, OR_EXPR:
+		return simplifyChain(exp)
+
+	case ATLEAST_EXPR:
+		return simplifyAtLeast(exp)
+
+	default:
+		simplified := *exp
+		return &simplified
+	}
+}
+
+// simplifyChain simplifies the chain of AND or OR expressions that starts on exp.
+// The operands of the chain are simplified, the duplicated ones are removed and
+// the constants are folded. The remaining operands are joined from left to right.
+func simplifyChain(exp *Expression) *Expression {
+	// absorbing is the constant that makes the whole chain equal to it
+	absorbing, neutral := FALSE_EXPR, TRUE_EXPR
+	if exp.Type == OR_EXPR {
+		absorbing, neutral = TRUE_EXPR, FALSE_EXPR
+	}
+
+	var operands []*Expression
+	seen := make(map[string]struct{})
+	for _, operand := range chainOperands(exp, exp.Type, nil) {
+		operand = simplify(operand)
+		// the operands of simplified sub chains of the same type are already simplified
+		for _, op := range chainOperands(operand, exp.Type, nil) {
+			switch op.Type {
+			case absorbing:
+				return &Expression{Type: absorbing}
+			case neutral:
+				continue
+			}
+
+			key := op.Format()
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			if _, ok := seen[complementKey(op)]; ok {
+				return &Expression{Type: absorbing}
+			}
+			seen[key] = struct{}{}
+			operands = append(operands, op)
+		}
+	}
+
+	if len(operands) == 0 {
+		return &Expression{Type: neutral}
+	}
+	result := operands[0]
+	for _, op := range operands[1:] {
+		result = &Expression{Type: exp.Type, LExpr: result, RExpr: op}
+	}
+	return result
+}
+
+// simplifyAtLeast simplifies the operands of the ATLEAST expression and folds the
+// constants, the true ones decrease the count and the false ones are removed.
+// The expression is replaced by an OR chain if only one of the remaining operands
+// needs to be true and by an AND chain if all of them need to be true.
+func simplifyAtLeast(exp *Expression) *Expression {
+	count := exp.Count
+	var operands []*Expression
+	for _, operand := range exp.Exprs {
+		operand = simplify(operand)
+		switch operand.Type {
+		case TRUE_EXPR:
+			count--
+		case FALSE_EXPR:
+		default:
+			operands = append(operands, operand)
+		}
+	}
+
+	switch {
+	case count <= 0:
+		return &Expression{Type: TRUE_EXPR}
+	case count > len(operands):
+		return &Expression{Type: FALSE_EXPR}
+	case len(operands) == 1:
+		return operands[0]
+	case count == 1 || count == len(operands):
+		chainType := OR_EXPR
+		if count == len(operands) {
+			chainType = AND_EXPR
+		}
+		chain := operands[0]
+		for _, op := range operands[1:] {
+			chain = &Expression{Type: chainType, LExpr: chain, RExpr: op}
+		}
+		return simplifyChain(chain)
+	default:
+		return &Expression{Type: ATLEAST_EXPR, Count: count, Exprs: operands}
+	}
+}
+
+// chainOperands appends the operands of the chain of expressions of the given
+// type that starts on exp, from left to right.
+func chainOperands(exp *Expression, chainType ExprType, operands []*Expression) []*Expression {
+	if exp.Type != chainType {
+		return append(operands, exp)
+	}
+	operands = chainOperands(exp.LExpr, chainType, operands)
+	return chainOperands(exp.RExpr, chainType, operands)
+}
+
+// complementKey returns the formatted negation of the simplified expression.
+func complementKey(exp *Expression) string {
+	if exp.Type == NOT_EXPR {
+		return exp.RExpr.Format()
+	}
+	return (&Expression{Type: NOT_EXPR, RExpr: exp}).Format()
+}
@@ -0,0 +1,147 @@
+package dsl
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimplify(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		expStr      string
+		expectedStr string
+		message     string
+	}{
+		{expStr: `not not "a"`, expectedStr: `"a"`, message: "double negation"},
+		{expStr: `not not not "a"`, expectedStr: `not "a"`, message: "triple negation"},
+		{expStr: `"a" and "a"`, expectedStr: `"a"`, message: "and idempotence"},
+		{expStr: `("a" or "b") or "a"`, expectedStr: `"a" or "b"`, message: "or idempotence"},
+		{expStr: `("a" or "b") or ("c" or "d")`, expectedStr: `"a" or "b" or "c" or "d"`, message: "or flattening"},
+		{expStr: `"a" and ("b" and ("c" and "a"))`, expectedStr: `"a" and "b" and "c"`, message: "and flattening"},
+		{expStr: `not not ("a" and "b") and "c"`, expectedStr: `"a" and "b" and "c"`, message: "flattening after double negation"},
+		{expStr: `"a:f1" and "a"`, expectedStr: `"a:f1" and "a"`, message: "different field paths"},
+		{expStr: `"a" and not "a"`, expectedStr: `false`, message: "and complement"},
+		{expStr: `"a" or "b" or not "a"`, expectedStr: `true`, message: "or complement"},
+		{expStr: `not ("a" and "b") or "b" and "a" or "a" and "b"`, expectedStr: `true`, message: "complement of chain"},
+		{expStr: `"a" and true`, expectedStr: `"a"`, message: "and neutral constant"},
+		{expStr: `"a" and ("b" or false)`, expectedStr: `"a" and "b"`, message: "or neutral constant"},
+		{expStr: `"a" or true`, expectedStr: `true`, message: "or absorbing constant"},
+		{expStr: `"a" and not ("b" or true)`, expectedStr: `false`, message: "and absorbing constant"},
+		{expStr: `not true`, expectedStr: `false`, message: "not constant"},
+		{expStr: `true and true`, expectedStr: `true`, message: "only neutral constants"},
+		{expStr: `"a" or "b" and "c"`, expectedStr: `"a" or "b" and "c"`, message: "nothing to simplify"},
+		{expStr: `atleast(2, "a", true, false)`, expectedStr: `"a"`, message: "atleast constants"},
+		{expStr: `anyof("a", "b" or "c", not not "d")`, expectedStr: `"a" or "b" or "c" or "d"`, message: "anyof as or"},
+		{expStr: `atleast(3, "a", "b", "c" and "d")`, expectedStr: `"a" and "b" and "c" and "d"`, message: "atleast all as and"},
+		{expStr: `atleast(2, "a", "b", not not "c")`, expectedStr: `atleast(2, "a", "b", "c")`, message: "atleast operands"},
+		{expStr: `atleast(2, "a", false, false)`, expectedStr: `false`, message: "atleast not reachable"},
+		{expStr: `atleast(2, "a", true, true)`, expectedStr: `true`, message: "atleast reached"},
+		{expStr: `count("a") > 1 and true`, expectedStr: `count("a") > 1`, message: "count"},
+	}
+
+	for _, tc := range tests {
+		exp, err := NewParser(strings.NewReader(tc.expStr)).Parse()
+		assert.Nil(err, tc.message)
+		original := exp.PrettyFormat()
+		simplified, err := Simplify(exp)
+		assert.Nil(err, tc.message)
+		assert.Equal(tc.expectedStr, simplified.Format(), tc.message)
+		assert.Equal(original, exp.PrettyFormat(), tc.message+" original is not changed")
+	}
+
+	_, err := Simplify(&Expression{Type: NOT_EXPR})
+	assert.Equal(fmt.Errorf("NOT statement do not have expression: not "), err, "invalid expression")
+}
+
+// randomExpression returns a random valid expression with the given max depth.
+func randomExpression(rnd *rand.Rand, depth int) *Expression {
+	if depth == 0 || rnd.Intn(4) == 0 {
+		tag := TagInfo{Name: []string{"a", "b", "c"}[rnd.Intn(3)]}
+		if rnd.Intn(2) == 0 {
+			tag.FieldPath = "f1"
+		}
+		switch rnd.Intn(10) {
+		case 0:
+			return &Expression{Type: TRUE_EXPR}
+		case 1:
+			return &Expression{Type: FALSE_EXPR}
+		case 2:
+			return &Expression{Type: COUNT_EXPR, Tag: tag, Operator: CompareOp(1 + rnd.Intn(6)), Count: rnd.Intn(2)}
+		}
+		return &Expression{Type: UNIT_EXPR, Tag: tag}
+	}
+
+	switch rnd.Intn(4) {
+	case 3:
+		exp := &Expression{Type: ATLEAST_EXPR}
+		for n := 2 + rnd.Intn(3); n > 0; n-- {
+			exp.Exprs = append(exp.Exprs, randomExpression(rnd, depth-1))
+		}
+		exp.Count = 1 + rnd.Intn(len(exp.Exprs))
+		return exp
+	case 0:
+		return &Expression{Type: NOT_EXPR, RExpr: randomExpression(rnd, depth-1)}
+	case 1:
+		return &Expression{Type: AND_EXPR, LExpr: randomExpression(rnd, depth-1), RExpr: randomExpression(rnd, depth-1)}
+	default:
+		return &Expression{Type: OR_EXPR, LExpr: randomExpression(rnd, depth-1), RExpr: randomExpression(rnd, depth-1)}
+	}
+}
+
+// allFieldPathByTag returns all combinations of the tags a, b and c
+// not being found, being found at f1 or being found at f2.
+func allFieldPathByTag() []map[string][]string {
+	combinations := []map[string][]string{{}}
+	for _, tag := range []string{"a", "b", "c"} {
+		var next []map[string][]string
+		for _, comb := range combinations {
+			for _, fieldPaths := range [][]string{nil, {"f1.x"}, {"f2"}} {
+				fieldPathByTag := make(map[string][]string)
+				for k, v := range comb {
+					fieldPathByTag[k] = v
+				}
+				if fieldPaths != nil {
+					fieldPathByTag[tag] = fieldPaths
+				}
+				next = append(next, fieldPathByTag)
+			}
+		}
+		combinations = next
+	}
+	return combinations
+}
+
+func TestSimplifyProperties(t *testing.T) {
+	assert := assert.New(t)
+	rnd := rand.New(rand.NewSource(42))
+	combinations := allFieldPathByTag()
+
+	for i := 0; i < 1000; i++ {
+		exp := randomExpression(rnd, 5)
+		expStr := exp.Format()
+		original := exp.PrettyFormat()
+		simplified, err := Simplify(exp)
+		assert.Nil(err, expStr)
+
+		for _, fieldPathByTag := range combinations {
+			expected, err := exp.Solve(fieldPathByTag)
+			assert.Nil(err, expStr)
+			resp, err := simplified.Solve(fieldPathByTag)
+			assert.Nil(err, expStr)
+			assert.Equal(expected, resp, fmt.Sprintf("%s => %s with %v", expStr, simplified, fieldPathByTag))
+		}
+
+		again, err := Simplify(simplified)
+		assert.Nil(err, expStr)
+		assert.Equal(simplified, again, expStr+" simplify is idempotent")
+
+		parsed, err := NewParser(strings.NewReader(simplified.Format())).Parse()
+		assert.Nil(err, expStr)
+		assert.Equal(simplified, parsed, expStr+" simplified round trip")
+		assert.Equal(original, exp.PrettyFormat(), expStr+" original is not changed")
+	}
+}
@@ -5,6 +5,7 @@ go 1.17
 require (
 	github.com/pedroegsilva/gofindthem v0.3.0
 	github.com/stretchr/testify v1.7.0
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c
 )
 
 require (
@@ -14,5 +15,4 @@ require (
 	github.com/davecgh/go-spew v1.1.0 // indirect
 	github.com/pedroegsilva/ahocorasick v0.1.0 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c // indirect
 )
@@ -0,0 +1,147 @@
+package tagger
+
+import (
+	"context"
+	"sync"
+)
+
+// taggerRun runs a single tagger on the value of a field. It returns a nil
+// TaggerInfo if the tagger is not valid for the value.
+type taggerRun func(ctx context.Context) (taggerName string, info *TaggerInfo, err error)
+
+// taggerResult stores the result of a taggerRun.
+type taggerResult struct {
+	taggerName string
+	info       *TaggerInfo
+}
+
+// taggerJob is a taggerRun that will be executed by a worker.
+type taggerJob struct {
+	run    taggerRun
+	result *taggerResult
+}
+
+// fieldCollector collects the information generated by the taggers of each field.
+// If it has workers the taggers are executed concurrently, otherwise they are executed
+// serially as the fields are added. In both cases the order of the fields is the
+// order that they were added. When the context is done no more fields are accepted
+// and the remaining taggers are skipped.
+type fieldCollector struct {
+	ctx        context.Context
+	fieldsInfo FieldsInfo
+	results    [][]taggerResult
+	jobs       chan taggerJob
+	wg         sync.WaitGroup
+	mu         sync.Mutex
+	err        error
+}
+
+// newFieldCollector returns a fieldCollector that uses the number of workers set on the tagger.
+func (rf *Tagger) newFieldCollector(ctx context.Context) *fieldCollector {
+	fc := &fieldCollector{ctx: ctx}
+	if rf.workers < 2 {
+		return fc
+	}
+
+	fc.jobs = make(chan taggerJob, rf.workers)
+	fc.wg.Add(rf.workers)
+	for i := 0; i < rf.workers; i++ {
+		go fc.work()
+	}
+	return fc
+}
+
+// add adds the field with the given name and the runs of the taggers that will tag it.
+func (fc *fieldCollector) add(fieldName string, runs []taggerRun) error {
+	if err := fc.ctx.Err(); err != nil {
+		return err
+	}
+
+	if fc.jobs == nil {
+		extractorInfoByTaggerName := make(map[string]TaggerInfo)
+		for _, run := range runs {
+			taggerName, info, err := run(fc.ctx)
+			if err != nil {
+				return err
+			}
+			if info != nil {
+				extractorInfoByTaggerName[taggerName] = *info
+			}
+		}
+		fc.fieldsInfo = append(fc.fieldsInfo, &FieldInfo{Name: fieldName, Taggers: extractorInfoByTaggerName})
+		return nil
+	}
+
+	if err := fc.getErr(); err != nil {
+		return err
+	}
+
+	results := make([]taggerResult, len(runs))
+	fc.results = append(fc.results, results)
+	fc.fieldsInfo = append(fc.fieldsInfo, &FieldInfo{Name: fieldName})
+	for i, run := range runs {
+		fc.jobs <- taggerJob{run: run, result: &results[i]}
+	}
+	return nil
+}
+
+// wait waits for all taggers to finish and returns the information of all fields.
+func (fc *fieldCollector) wait() (FieldsInfo, error) {
+	if fc.jobs == nil {
+		return fc.fieldsInfo, nil
+	}
+
+	close(fc.jobs)
+	fc.wg.Wait()
+	if fc.err != nil {
+		return nil, fc.err
+	}
+
+	for i, fieldInfo := range fc.fieldsInfo {
+		fieldInfo.Taggers = make(map[string]TaggerInfo)
+		for _, res := range fc.results[i] {
+			if res.info != nil {
+				fieldInfo.Taggers[res.taggerName] = *res.info
+			}
+		}
+	}
+	return fc.fieldsInfo, nil
+}
+
+// work executes the jobs until the jobs channel is closed. After the first
+// error, or after the context is done, the remaining jobs are skipped.
+func (fc *fieldCollector) work() {
+	defer fc.wg.Done()
+	for job := range fc.jobs {
+		if fc.getErr() != nil {
+			continue
+		}
+		if err := fc.ctx.Err(); err != nil {
+			fc.setErr(err)
+			continue
+		}
+		taggerName, info, err := job.run(fc.ctx)
+		if err != nil {
+			fc.setErr(err)
+			continue
+		}
+		job.result.taggerName = taggerName
+		job.result.info = info
+	}
+}
+
+// getErr returns the first error found by the workers.
+func (fc *fieldCollector) getErr() error {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.err
+}
+
+// setErr stores the error if it is the first one.
+func (fc *fieldCollector) setErr(err error) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if fc.err == nil {
+		fc.err = err
+	}
+}
@@ -0,0 +1,157 @@
+package tagger
+
+import (
+	"context"
+)
+
+// StringContextTagger interface of a tagger that process strings using a context
+type StringContextTagger interface {
+	IsValid(data string) bool
+	GetTagsContext(ctx context.Context, data string) (tags []string, runData interface{}, err error)
+	GetName() string
+}
+
+// IntContextTagger interface of a tagger that process integers using a context
+type IntContextTagger interface {
+	IsValid(data int64) bool
+	GetTagsContext(ctx context.Context, data int64) (tags []string, runData interface{}, err error)
+	GetName() string
+}
+
+// FloatContextTagger interface of a tagger that process floats using a context
+type FloatContextTagger interface {
+	IsValid(data float64) bool
+	GetTagsContext(ctx context.Context, data float64) (tags []string, runData interface{}, err error)
+	GetName() string
+}
+
+// BoolContextTagger interface of a tagger that process booleans using a context
+type BoolContextTagger interface {
+	IsValid(data bool) bool
+	GetTagsContext(ctx context.Context, data bool) (tags []string, runData interface{}, err error)
+	GetName() string
+}
+
+// stringTaggerAdapter adapts a StringTagger to a StringContextTagger
+type stringTaggerAdapter struct {
+	StringTagger
+}
+
+// NewStringContextTagger returns a StringContextTagger that runs the given StringTagger
+// if the context was not canceled.
+func NewStringContextTagger(tagger StringTagger) StringContextTagger {
+	return &stringTaggerAdapter{StringTagger: tagger}
+}
+
+// GetTagsContext calls GetTags of the adapted tagger if the context is not done.
+func (sta *stringTaggerAdapter) GetTagsContext(ctx context.Context, data string) (tags []string, runData interface{}, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	return sta.GetTags(data)
+}
+
+// intTaggerAdapter adapts a IntTagger to a IntContextTagger
+type intTaggerAdapter struct {
+	IntTagger
+}
+
+// NewIntContextTagger returns a IntContextTagger that runs the given IntTagger
+// if the context was not canceled.
+func NewIntContextTagger(tagger IntTagger) IntContextTagger {
+	return &intTaggerAdapter{IntTagger: tagger}
+}
+
+// GetTagsContext calls GetTags of the adapted tagger if the context is not done.
+func (ita *intTaggerAdapter) GetTagsContext(ctx context.Context, data int64) (tags []string, runData interface{}, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	return ita.GetTags(data)
+}
+
+// floatTaggerAdapter adapts a FloatTagger to a FloatContextTagger
+type floatTaggerAdapter struct {
+	FloatTagger
+}
+
+// NewFloatContextTagger returns a FloatContextTagger that runs the given FloatTagger
+// if the context was not canceled.
+func NewFloatContextTagger(tagger FloatTagger) FloatContextTagger {
+	return &floatTaggerAdapter{FloatTagger: tagger}
+}
+
+// GetTagsContext calls GetTags of the adapted tagger if the context is not done.
+func (fta *floatTaggerAdapter) GetTagsContext(ctx context.Context, data float64) (tags []string, runData interface{}, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	return fta.GetTags(data)
+}
+
+// boolTaggerAdapter adapts a BoolTagger to a BoolContextTagger
+type boolTaggerAdapter struct {
+	BoolTagger
+}
+
+// NewBoolContextTagger returns a BoolContextTagger that runs the given BoolTagger
+// if the context was not canceled.
+func NewBoolContextTagger(tagger BoolTagger) BoolContextTagger {
+	return &boolTaggerAdapter{BoolTagger: tagger}
+}
+
+// GetTagsContext calls GetTags of the adapted tagger if the context is not done.
+func (bta *boolTaggerAdapter) GetTagsContext(ctx context.Context, data bool) (tags []string, runData interface{}, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	return bta.GetTags(data)
+}
+
+// adaptStringTaggers adapts all the given taggers to StringContextTagger
+func adaptStringTaggers(taggers []StringTagger) []StringContextTagger {
+	if taggers == nil {
+		return nil
+	}
+	adapted := make([]StringContextTagger, 0, len(taggers))
+	for _, tagger := range taggers {
+		adapted = append(adapted, NewStringContextTagger(tagger))
+	}
+	return adapted
+}
+
+// adaptIntTaggers adapts all the given taggers to IntContextTagger
+func adaptIntTaggers(taggers []IntTagger) []IntContextTagger {
+	if taggers == nil {
+		return nil
+	}
+	adapted := make([]IntContextTagger, 0, len(taggers))
+	for _, tagger := range taggers {
+		adapted = append(adapted, NewIntContextTagger(tagger))
+	}
+	return adapted
+}
+
+// adaptFloatTaggers adapts all the given taggers to FloatContextTagger
+func adaptFloatTaggers(taggers []FloatTagger) []FloatContextTagger {
+	if taggers == nil {
+		return nil
+	}
+	adapted := make([]FloatContextTagger, 0, len(taggers))
+	for _, tagger := range taggers {
+		adapted = append(adapted, NewFloatContextTagger(tagger))
+	}
+	return adapted
+}
+
+// adaptBoolTaggers adapts all the given taggers to BoolContextTagger
+func adaptBoolTaggers(taggers []BoolTagger) []BoolContextTagger {
+	if taggers == nil {
+		return nil
+	}
+	adapted := make([]BoolContextTagger, 0, len(taggers))
+	for _, tagger := range taggers {
+		adapted = append(adapted, NewBoolContextTagger(tagger))
+	}
+	return adapted
+}
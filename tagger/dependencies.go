@@ -0,0 +1,122 @@
+package tagger
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// UndefinedRuleError is the error returned when a rule references (eg: rule("name"))
+// a rule that does not exist on the tagger.
+type UndefinedRuleError struct {
+	RuleName  string
+	Reference string
+}
+
+// Error returns the rule name and the undefined rule.
+func (ure *UndefinedRuleError) Error() string {
+	return fmt.Sprintf("rule %q references the undefined rule %q", ure.RuleName, ure.Reference)
+}
+
+// RuleCycleError is the error returned when the rule references form a cycle.
+// Cycle starts and ends with the same rule, eg: [a b a] for a rule "a" that
+// references "b" that references "a".
+type RuleCycleError struct {
+	Cycle []string
+}
+
+// Error returns the rules of the cycle.
+func (rce *RuleCycleError) Error() string {
+	return fmt.Sprintf("rule cycle found: %s", strings.Join(rce.Cycle, " -> "))
+}
+
+// ruleDependencies returns the sorted unique rules referenced by the expressions.
+func ruleDependencies(exprWrappers []ExpressionWrapper) (deps []string) {
+	seen := make(map[string]struct{})
+	for _, ew := range exprWrappers {
+		for _, ruleName := range ew.Expression.GetRules() {
+			if _, ok := seen[ruleName]; !ok {
+				seen[ruleName] = struct{}{}
+				deps = append(deps, ruleName)
+			}
+		}
+	}
+	sort.Strings(deps)
+	return
+}
+
+// checkRuleReferences returns an UndefinedRuleError if any of the given rules references
+// a rule that does not exist, or a RuleCycleError if the references of any rule form a cycle.
+// The undefined references are only checked for the given rules, so the rules that reference
+// a removed rule are kept (the reference is evaluated as false).
+func (rs *ruleSet) checkRuleReferences(ruleNames []string) error {
+	sorted := append([]string(nil), ruleNames...)
+	sort.Strings(sorted)
+	for _, ruleName := range sorted {
+		for _, dep := range ruleDependencies(rs.expressionWrapperByExprName[ruleName]) {
+			if _, ok := rs.expressionWrapperByExprName[dep]; !ok {
+				return &UndefinedRuleError{RuleName: ruleName, Reference: dep}
+			}
+		}
+	}
+
+	_, err := sortRulesByDependencies(rs.expressionWrapperByExprName)
+	return err
+}
+
+// sortRulesByDependencies returns the names of the rules sorted so each rule comes after
+// the rules that it references, the rules that do not depend on each other are sorted by
+// name. Returns a RuleCycleError if the references form a cycle.
+func sortRulesByDependencies(expressionWrapperByExprName map[string][]ExpressionWrapper) ([]string, error) {
+	names := make([]string, 0, len(expressionWrapperByExprName))
+	for name := range expressionWrapperByExprName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(names))
+	sorted := make([]string, 0, len(names))
+	var path []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			for i, pathName := range path {
+				if pathName == name {
+					cycle := append(append([]string(nil), path[i:]...), name)
+					return &RuleCycleError{Cycle: cycle}
+				}
+			}
+		}
+
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range ruleDependencies(expressionWrapperByExprName[name]) {
+			// undefined rules are never true, so they do not need to be sorted
+			if _, ok := expressionWrapperByExprName[dep]; !ok {
+				continue
+			}
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		sorted = append(sorted, name)
+		return nil
+	}
+
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
@@ -0,0 +1,160 @@
+package tagger
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuleReferencesErrors(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		rulesByName map[string][]string
+		expectedErr error
+		message     string
+	}{
+		{
+			rulesByName: map[string][]string{
+				"a": {`rule("b") and "tag1"`},
+				"b": {`"tag2"`},
+			},
+			expectedErr: nil,
+			message:     "reference on the same batch",
+		},
+		{
+			rulesByName: map[string][]string{
+				"a": {`"tag1"`, `rule("c") or rule("b")`},
+				"b": {`"tag2"`},
+			},
+			expectedErr: &UndefinedRuleError{RuleName: "a", Reference: "c"},
+			message:     "undefined rule",
+		},
+		{
+			rulesByName: map[string][]string{
+				"a": {`"tag1" or rule("a")`},
+			},
+			expectedErr: &RuleCycleError{Cycle: []string{"a", "a"}},
+			message:     "self reference",
+		},
+		{
+			rulesByName: map[string][]string{
+				"a": {`rule("b")`},
+				"b": {`"tag1"`, `not rule("c")`},
+				"c": {`anyof(rule("a"), "tag2")`},
+				"d": {`rule("a")`},
+			},
+			expectedErr: &RuleCycleError{Cycle: []string{"a", "b", "c", "a"}},
+			message:     "indirect cycle",
+		},
+	}
+
+	for _, tc := range tests {
+		tagger, err := NewTaggerWithRules(nil, nil, nil, tc.rulesByName)
+		assert.Equal(tc.expectedErr, err, tc.message+" add rules")
+		if tc.expectedErr != nil {
+			assert.Empty(tagger.loadRules().expressionWrapperByExprName, tc.message+" rules are not added")
+		}
+
+		tagger = NewTagger(nil, nil, nil)
+		assert.Equal(tc.expectedErr, tagger.ReloadRules(tc.rulesByName), tc.message+" reload rules")
+	}
+	assert.Equal(`rule "a" references the undefined rule "c"`, tests[1].expectedErr.Error())
+	assert.Equal(`rule cycle found: a -> b -> c -> a`, tests[3].expectedErr.Error())
+}
+
+func TestAddRuleReferences(t *testing.T) {
+	assert := assert.New(t)
+	tagger := NewTagger(nil, nil, nil)
+	assert.Equal(&UndefinedRuleError{RuleName: "a", Reference: "b"}, tagger.AddRule("a", []string{`rule("b")`}), "undefined rule")
+	assert.Nil(tagger.AddRule("b", []string{`"tag1"`}), "add referenced rule")
+	assert.Nil(tagger.AddRule("a", []string{`rule("b")`}), "add rule with reference")
+	assert.Equal(&RuleCycleError{Cycle: []string{"a", "b", "a"}}, tagger.AddRule("b", []string{`rule("a")`}), "add creates cycle")
+	assert.Equal(&RuleCycleError{Cycle: []string{"a", "b", "a"}}, tagger.ReplaceRule("b", []string{`rule("a")`}), "replace creates cycle")
+	assert.Equal(map[string][]string{"a": {`rule("b")`}, "b": {`"tag1"`}}, mustEvaluate(t, tagger, map[string][]string{"tag1": nil}), "rules are kept")
+
+	assert.True(tagger.RemoveRule("b"), "remove referenced rule")
+	assert.Equal(map[string][]string{}, mustEvaluate(t, tagger, map[string][]string{"tag1": nil}), "removed rule is not fired")
+	assert.Nil(tagger.ReplaceRule("a", []string{`"tag1"`}), "replace rule with dangling reference")
+}
+
+func TestEvaluateRulesReferences(t *testing.T) {
+	assert := assert.New(t)
+	tagger, err := NewTaggerWithRules(nil, nil, nil, map[string][]string{
+		"a": {`rule("pii") and "tag3"`},
+		"b": {`not rule("a")`},
+		"c": {`atleast(2, rule("a"), rule("pii"), "tag4")`},
+		"pii": {
+			`"email" or "phone"`,
+			`"ssn"`,
+		},
+	})
+	assert.Nil(err)
+
+	index := tagger.loadRules().getIndex()
+	var refs []string
+	for _, ie := range index.exprs {
+		refs = append(refs, fmt.Sprintf("%s %d", ie.ruleName, ie.index))
+	}
+	assert.Equal([]string{"pii 0", "pii 1", "a 0", "b 0", "c 0"}, refs, "rules after their references")
+	assert.Equal(map[string][]int{
+		"pii": {2, 4},
+		"a":   {4},
+	}, index.idsByRule, "ids by rule, the expressions true without tags are always candidates")
+
+	tests := []struct {
+		fieldsByTag map[string][]string
+		expected    map[string][]string
+		message     string
+	}{
+		{
+			fieldsByTag: map[string][]string{},
+			expected:    map[string][]string{"b": {`not rule("a")`}},
+			message:     "no tags",
+		},
+		{
+			fieldsByTag: map[string][]string{"ssn": nil},
+			expected: map[string][]string{
+				"pii": {`"ssn"`},
+				"b":   {`not rule("a")`},
+			},
+			message: "referenced rule without dependents",
+		},
+		{
+			fieldsByTag: map[string][]string{"email": nil, "ssn": nil, "tag3": nil},
+			expected: map[string][]string{
+				"pii": {`"email" or "phone"`, `"ssn"`},
+				"a":   {`rule("pii") and "tag3"`},
+				"c":   {`atleast(2, rule("a"), rule("pii"), "tag4")`},
+			},
+			message: "chained references",
+		},
+		{
+			fieldsByTag: map[string][]string{"tag3": nil},
+			expected:    map[string][]string{"b": {`not rule("a")`}},
+			message:     "tag without the referenced rule",
+		},
+	}
+	for _, tc := range tests {
+		assert.Equal(tc.expected, mustEvaluate(t, tagger, tc.fieldsByTag), tc.message)
+	}
+
+	results, err := tagger.EvaluateRulesDetailed(map[string][]string{"phone": {"user.phone"}, "tag3": {"user.name"}})
+	assert.Nil(err)
+	var resultRefs []string
+	for _, res := range results {
+		resultRefs = append(resultRefs, fmt.Sprintf("%s %d", res.RuleName, res.ExpressionIndex))
+	}
+	assert.Equal([]string{"a 0", "c 0", "pii 0"}, resultRefs, "detailed results sorted by rule name")
+	assert.Equal([]TagMatch{{Tag: "tag3", FieldPath: "user.name"}}, results[0].Matches, "matches of the rule")
+}
+
+// mustEvaluate returns the result of EvaluateRules, failing the test on errors.
+func mustEvaluate(t *testing.T, tagger *Tagger, fieldsByTag map[string][]string) map[string][]string {
+	t.Helper()
+	expressionsByRule, err := tagger.EvaluateRules(fieldsByTag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return expressionsByRule
+}
@@ -0,0 +1,148 @@
+package tagger
+
+import (
+	"container/heap"
+	"sort"
+
+	"github.com/pedroegsilva/gotagthem/dsl"
+)
+
+// indexedExpression is an expression of a rule stored on the ruleIndex.
+type indexedExpression struct {
+	ruleName string
+	index    int
+	ew       ExpressionWrapper
+}
+
+// ruleIndex is an inverted index from the tags and the referenced rules to the expressions
+// that reference them. An expression can only be true if one of its tags was found, if one
+// of its referenced rules is true or if it is true when no tag is found (eg: not "tag1"),
+// so only these expressions need to be solved.
+type ruleIndex struct {
+	// exprs are all expressions sorted by the rule dependencies (the rules come after the
+	// rules that they reference), rule name and position on the rule.
+	// The ids used on the index are the positions on this list.
+	exprs     []indexedExpression
+	idsByTag  map[string][]int
+	idsByRule map[string][]int
+	alwaysIDs []int
+	// fieldPaths are the compiled glob and regex field paths of the expressions.
+	fieldPaths dsl.FieldPathMatchers
+}
+
+// newRuleIndex returns the index of the given rules.
+func newRuleIndex(expressionWrapperByExprName map[string][]ExpressionWrapper) *ruleIndex {
+	names, err := sortRulesByDependencies(expressionWrapperByExprName)
+	if err != nil {
+		// the cycles are rejected when the rules are changed, the rules are
+		// still indexed by name so the other rules can be evaluated
+		names = make([]string, 0, len(expressionWrapperByExprName))
+		for name := range expressionWrapperByExprName {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	ri := &ruleIndex{
+		idsByTag:  make(map[string][]int),
+		idsByRule: make(map[string][]int),
+	}
+	var fieldPaths []string
+	for _, name := range names {
+		for i, ew := range expressionWrapperByExprName[name] {
+			id := len(ri.exprs)
+			ri.exprs = append(ri.exprs, indexedExpression{ruleName: name, index: i, ew: ew})
+			fieldPaths = append(fieldPaths, ew.Expression.GetFields()...)
+
+			// expressions that fail are kept as candidates so the error is returned on the evaluation
+			eval, err := ew.Expression.Solve(map[string][]string{})
+			if err != nil || eval {
+				ri.alwaysIDs = append(ri.alwaysIDs, id)
+				continue
+			}
+			for _, tag := range ew.Expression.GetTags() {
+				ri.idsByTag[tag] = append(ri.idsByTag[tag], id)
+			}
+			for _, ruleName := range ew.Expression.GetRules() {
+				ri.idsByRule[ruleName] = append(ri.idsByRule[ruleName], id)
+			}
+		}
+	}
+	ri.fieldPaths = dsl.CompileFieldPaths(fieldPaths)
+	return ri
+}
+
+// candidates returns the ids of the expressions that can be true with the given tags,
+// in the order of the index.
+func (ri *ruleIndex) candidates(fieldsByTag map[string][]string) []int {
+	seen := make(map[int]struct{}, len(ri.alwaysIDs))
+	ids := append([]int(nil), ri.alwaysIDs...)
+	for _, id := range ri.alwaysIDs {
+		seen[id] = struct{}{}
+	}
+
+	for tag := range fieldsByTag {
+		for _, id := range ri.idsByTag[tag] {
+			if _, ok := seen[id]; ok {
+				continue
+			}
+			seen[id] = struct{}{}
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// evaluate calls solve with the candidate expressions in the order of the index and the
+// rules that have an expression solved as true so far. Since the rules come after the rules
+// that they reference, the references are solved with the final result of the rules.
+// The expressions that reference a rule become candidates when the rule is true.
+func (ri *ruleIndex) evaluate(
+	fieldsByTag map[string][]string,
+	solve func(id int, firedRules map[string]bool) (bool, error),
+) error {
+	// the candidates are sorted, so they are already a heap
+	ids := idHeap(ri.candidates(fieldsByTag))
+	seen := make(map[int]struct{}, len(ids))
+	for _, id := range ids {
+		seen[id] = struct{}{}
+	}
+
+	firedRules := make(map[string]bool)
+	for len(ids) > 0 {
+		id := heap.Pop(&ids).(int)
+		eval, err := solve(id, firedRules)
+		if err != nil {
+			return err
+		}
+		ruleName := ri.exprs[id].ruleName
+		if !eval || firedRules[ruleName] {
+			continue
+		}
+
+		firedRules[ruleName] = true
+		for _, depID := range ri.idsByRule[ruleName] {
+			if _, ok := seen[depID]; ok {
+				continue
+			}
+			seen[depID] = struct{}{}
+			heap.Push(&ids, depID)
+		}
+	}
+	return nil
+}
+
+// idHeap is a min heap of expression ids.
+type idHeap []int
+
+func (h idHeap) Len() int            { return len(h) }
+func (h idHeap) Less(i, j int) bool  { return h[i] < h[j] }
+func (h idHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *idHeap) Push(x interface{}) { *h = append(*h, x.(int)) }
+func (h *idHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
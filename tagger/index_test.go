@@ -0,0 +1,139 @@
+package tagger
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuleIndex(t *testing.T) {
+	assert := assert.New(t)
+	tagger, err := NewTaggerWithRules(nil, nil, nil, map[string][]string{
+		"rule1": {`"tag1" and "tag2"`, `not "tag3"`},
+		"rule2": {`"tag2:field1" or "tag4"`},
+		"rule3": {`"tag5" or not ("tag1" and "tag6")`, `"tag6"`},
+	})
+	assert.Nil(err, "new tagger")
+
+	index := tagger.loadRules().getIndex()
+	var refs []string
+	for _, ie := range index.exprs {
+		refs = append(refs, fmt.Sprintf("%s %d", ie.ruleName, ie.index))
+	}
+	assert.Equal([]string{"rule1 0", "rule1 1", "rule2 0", "rule3 0", "rule3 1"}, refs, "expressions order")
+	assert.Equal([]int{1, 3}, index.alwaysIDs, "expressions true without tags")
+	assert.Equal(map[string][]int{
+		"tag1": {0},
+		"tag2": {0, 2},
+		"tag4": {2},
+		"tag6": {4},
+	}, index.idsByTag, "ids by tag")
+
+	tests := []struct {
+		fieldsByTag map[string][]string
+		expectedIDs []int
+		message     string
+	}{
+		{
+			fieldsByTag: map[string][]string{},
+			expectedIDs: []int{1, 3},
+			message:     "no tags",
+		},
+		{
+			fieldsByTag: map[string][]string{"tag2": {"field2"}, "tag6": {"field1"}, "tag7": {"field1"}},
+			expectedIDs: []int{0, 1, 2, 3, 4},
+			message:     "tags of many expressions",
+		},
+		{
+			fieldsByTag: map[string][]string{"tag3": {"field1"}},
+			expectedIDs: []int{1, 3},
+			message:     "negated tag",
+		},
+	}
+	for _, tc := range tests {
+		assert.Equal(tc.expectedIDs, index.candidates(tc.fieldsByTag), tc.message)
+	}
+
+	expressionsByRule, err := tagger.EvaluateRules(map[string][]string{"tag3": {"field1"}, "tag6": {"field1"}})
+	assert.Nil(err, "evaluate rules")
+	assert.Equal(map[string][]string{
+		"rule3": {`"tag5" or not ("tag1" and "tag6")`, `"tag6"`},
+	}, expressionsByRule, "evaluate rules")
+
+	assert.Same(index, tagger.loadRules().getIndex(), "index is built once")
+	assert.Nil(tagger.AddRule("rule4", []string{`"tag7"`}), "add rule")
+	assert.NotSame(index, tagger.loadRules().getIndex(), "index is rebuilt after changes")
+	assert.Equal([]int{5}, tagger.loadRules().getIndex().idsByTag["tag7"], "index is rebuilt after changes")
+}
+
+func TestRuleIndexFieldPaths(t *testing.T) {
+	assert := assert.New(t)
+	tagger, err := NewTaggerWithRules(nil, nil, nil, map[string][]string{
+		"rule1": {`"tag1:*.email" and "tag2:/^user\.id$/"`},
+		"rule2": {`"tag1:user" or "tag3:*.email"`},
+	})
+	assert.Nil(err, "new tagger")
+
+	index := tagger.loadRules().getIndex()
+	var patterns []string
+	for pattern := range index.fieldPaths {
+		patterns = append(patterns, pattern)
+	}
+	assert.ElementsMatch([]string{"*.email", `/^user\.id$/`}, patterns, "glob and regex field paths compiled once")
+
+	expressionsByRule, err := tagger.EvaluateRules(map[string][]string{"tag3": {"user.email"}})
+	assert.Nil(err, "evaluate rules")
+	assert.Equal(map[string][]string{"rule2": {`"tag1:user" or "tag3:*.email"`}}, expressionsByRule, "evaluate rules")
+}
+
+// benchmarkRules returns n rules where each one references its own tags.
+func benchmarkRules(n int) map[string][]string {
+	rulesByName := make(map[string][]string, n)
+	for i := 0; i < n; i++ {
+		rulesByName[fmt.Sprintf("rule%d", i)] = []string{
+			fmt.Sprintf(`"tag%d:field1" and ("tag%d" or not "tag%d")`, i, i+1, i+2),
+		}
+	}
+	return rulesByName
+}
+
+func BenchmarkEvaluateRules10k(b *testing.B) {
+	tagger, err := NewTaggerWithRules(nil, nil, nil, benchmarkRules(10000))
+	if err != nil {
+		b.Fatal(err)
+	}
+	fieldsByTag := map[string][]string{
+		"tag10":   {"field1.inner"},
+		"tag11":   {"field2"},
+		"tag5000": {"field1"},
+		"tag9999": {"field3"},
+	}
+
+	b.Run("index", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = tagger.EvaluateRules(fieldsByTag)
+		}
+	})
+	b.Run("all expressions", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, exprWrappers := range tagger.loadRules().expressionWrapperByExprName {
+				for _, ew := range exprWrappers {
+					_, _ = ew.Expression.Solve(fieldsByTag)
+				}
+			}
+		}
+	})
+}
+
+func BenchmarkBuildRuleIndex10k(b *testing.B) {
+	tagger, err := NewTaggerWithRules(nil, nil, nil, benchmarkRules(10000))
+	if err != nil {
+		b.Fatal(err)
+	}
+	rules := tagger.loadRules().expressionWrapperByExprName
+
+	for i := 0; i < b.N; i++ {
+		_ = newRuleIndex(rules)
+	}
+}
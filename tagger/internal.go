@@ -1,80 +1,146 @@
 package tagger
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"math"
 	"reflect"
 	"strings"
+
+	"github.com/pedroegsilva/gotagthem/dsl"
 )
 
-// setFieldInfos adds to the fieldsInfo the information extracteds by all the taggers
-func (rf *Tagger) setFieldInfos(
-	data interface{},
-	fieldName string,
-	fieldsInfo *FieldsInfo,
+// jsonNumberType is the type of the numbers decoded by json with UseNumber
+var jsonNumberType = reflect.TypeOf(json.Number(""))
+
+// visitKey identifies a pointer, map or slice that was visited. The type is needed since
+// different values can have the same address, eg: a struct and its first field, and the
+// length since the slices of the same array can start on the same address.
+type visitKey struct {
+	typ reflect.Type
+	ptr uintptr
+	len int
+}
+
+// tagValue tags all fields found on val using a new field collector.
+func (rf *Tagger) tagValue(
+	ctx context.Context,
+	val reflect.Value,
 	includePaths []string,
 	excludePaths []string,
-) (err error) {
-	t := reflect.TypeOf(data)
-
-	val := reflect.ValueOf(data)
+) (FieldsInfo, error) {
+	fc := rf.newFieldCollector(ctx)
+	filter := newFieldPathFilter(includePaths, excludePaths, rf.fieldPathMatching)
+	walkErr := rf.setFieldInfos(val, "", fc, filter, make(map[visitKey]struct{}))
+	fieldsInfo, err := fc.wait()
+	if walkErr != nil {
+		return nil, walkErr
+	}
+	return fieldsInfo, err
+}
 
+// setFieldInfos adds to the field collector the taggers of all fields found on val.
+// Pointers and interfaces are followed until a value is found, visited keeps the
+// types and addresses of the pointers, maps and slices on the current path to avoid cycles.
+func (rf *Tagger) setFieldInfos(
+	val reflect.Value,
+	fieldName string,
+	fc *fieldCollector,
+	filter *fieldPathFilter,
+	visited map[visitKey]struct{},
+) (err error) {
 	switch val.Kind() {
 	case reflect.String:
-		if !isValidateFieldPath(fieldName, includePaths, excludePaths) {
+		if !filter.isValid(fieldName) {
 			return
 		}
-
-		extractorInfoByTaggerName, err := rf.handleStringTaggers(val.String())
-		if err != nil {
-			return err
+		if val.Type() == jsonNumberType {
+			runs, err := rf.jsonNumberTaggerRuns(json.Number(val.String()))
+			if err != nil {
+				return err
+			}
+			return fc.add(fieldName, runs)
 		}
-		fieldInfo := &FieldInfo{Name: fieldName, Taggers: extractorInfoByTaggerName}
-		*fieldsInfo = append(*fieldsInfo, fieldInfo)
+		return fc.add(fieldName, rf.stringTaggerRuns(val.String()))
 
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		if !isValidateFieldPath(fieldName, includePaths, excludePaths) {
+		if !filter.isValid(fieldName) {
 			return
 		}
+		return fc.add(fieldName, rf.intTaggerRuns(val.Int()))
 
-		extractorInfoByTaggerName, err := rf.handleIntTaggers(val.Int())
-		if err != nil {
-			return err
+	case reflect.Float32, reflect.Float64:
+		if !filter.isValid(fieldName) {
+			return
 		}
-		fieldInfo := &FieldInfo{Name: fieldName, Taggers: extractorInfoByTaggerName}
-		*fieldsInfo = append(*fieldsInfo, fieldInfo)
+		return fc.add(fieldName, rf.floatTaggerRuns(val.Float()))
 
-	case reflect.Float32, reflect.Float64:
-		if !isValidateFieldPath(fieldName, includePaths, excludePaths) {
+	case reflect.Bool:
+		if !filter.isValid(fieldName) {
 			return
 		}
+		return fc.add(fieldName, rf.boolTaggerRuns(val.Bool()))
 
-		extractorInfoByTaggerName, err := rf.handleFloatTaggers(val.Float())
-		if err != nil {
-			return err
+	case reflect.Ptr:
+		if val.IsNil() {
+			return
+		}
+		key := visitKey{typ: val.Type(), ptr: val.Pointer()}
+		if _, ok := visited[key]; ok {
+			return
 		}
+		visited[key] = struct{}{}
+		defer delete(visited, key)
 
-		fieldInfo := &FieldInfo{Name: fieldName, Taggers: extractorInfoByTaggerName}
-		*fieldsInfo = append(*fieldsInfo, fieldInfo)
+		return rf.setFieldInfos(val.Elem(), fieldName, fc, filter, visited)
+
+	case reflect.Interface:
+		if val.IsNil() {
+			return
+		}
+		return rf.setFieldInfos(val.Elem(), fieldName, fc, filter, visited)
 
 	case reflect.Struct:
+		t := val.Type()
 		numField := t.NumField()
 
 		for i := 0; i < numField; i++ {
 			structField := t.Field(i)
-			fn := structField.Name
-			if fieldName != "" {
-				fn = fieldName + "." + fn
+			fn, ok := rf.structFieldName(structField)
+			if !ok {
+				continue
 			}
-			if !val.Field(i).CanInterface() {
+			// like encoding/json, the exported fields of the embedded structs are
+			// tagged even if the embedded type is unexported
+			embedded := rf.fieldTagKey != "" && isEmbeddedStruct(structField)
+			if !embedded && !val.Field(i).CanInterface() {
 				continue
 			}
-			err := rf.setFieldInfos(val.Field(i).Interface(), fn, fieldsInfo, includePaths, excludePaths)
+			switch {
+			case embedded && !rf.hasTagName(structField):
+				// the fields are promoted to the parent
+				fn = fieldName
+			case fieldName != "":
+				fn = fieldName + "." + fn
+			}
+			err := rf.setFieldInfos(val.Field(i), fn, fc, filter, visited)
 			if err != nil {
 				return err
 			}
 		}
 
 	case reflect.Map:
+		if val.IsNil() {
+			return
+		}
+		key := visitKey{typ: val.Type(), ptr: val.Pointer()}
+		if _, ok := visited[key]; ok {
+			return
+		}
+		visited[key] = struct{}{}
+		defer delete(visited, key)
+
 		iter := val.MapRange()
 		for iter.Next() {
 			k := iter.Key()
@@ -90,13 +156,21 @@ func (rf *Tagger) setFieldInfos(
 			if !v.CanInterface() {
 				continue
 			}
-			err := rf.setFieldInfos(v.Interface(), fn, fieldsInfo, includePaths, excludePaths)
+			err := rf.setFieldInfos(v, fn, fc, filter, visited)
 			if err != nil {
 				return err
 			}
 		}
 
 	case reflect.Array, reflect.Slice:
+		if val.Kind() == reflect.Slice && val.Len() > 0 {
+			key := visitKey{typ: val.Type(), ptr: val.Pointer(), len: val.Len()}
+			if _, ok := visited[key]; ok {
+				return
+			}
+			visited[key] = struct{}{}
+			defer delete(visited, key)
+		}
 		for i := 0; i < val.Len(); i++ {
 			fn := fmt.Sprintf("index(%d)", i)
 			if fieldName != "" {
@@ -105,7 +179,7 @@ func (rf *Tagger) setFieldInfos(
 			if !val.Index(i).CanInterface() {
 				continue
 			}
-			err := rf.setFieldInfos(val.Index(i).Interface(), fn, fieldsInfo, includePaths, excludePaths)
+			err := rf.setFieldInfos(val.Index(i), fn, fc, filter, visited)
 			if err != nil {
 				return err
 			}
@@ -115,81 +189,189 @@ func (rf *Tagger) setFieldInfos(
 	return
 }
 
-// handleFloatTaggers hander of taggers of the type float
-func (rf *Tagger) handleFloatTaggers(
-	data float64,
-) (extractorInfoByTaggerName map[string]TaggerInfo, err error) {
-	extractorInfoByTaggerName = make(map[string]TaggerInfo)
-	for _, extractor := range rf.floatTaggers {
-		if extractor.IsValid(data) {
-			tags, runData, err := extractor.GetTags(data)
-			if err != nil {
-				return nil, err
+// structFieldName returns the name of the struct field that will be used on the field path.
+// If the field has the struct tag set by SetFieldTagKey its name will be used instead and
+// if the name is "-" the field must be skipped, returning false.
+func (rf *Tagger) structFieldName(structField reflect.StructField) (name string, ok bool) {
+	if rf.fieldTagKey == "" {
+		return structField.Name, true
+	}
+
+	tag, found := structField.Tag.Lookup(rf.fieldTagKey)
+	if !found {
+		return structField.Name, true
+	}
+
+	if tag == "-" {
+		return "", false
+	}
+
+	name = tag
+	if idx := strings.Index(tag, ","); idx >= 0 {
+		name = tag[:idx]
+	}
+	if name == "" {
+		name = structField.Name
+	}
+	return name, true
+}
+
+// isEmbeddedStruct returns true if the struct field is an embedded struct or pointer to struct.
+// When the field tag key is set and the field does not have a name on the struct tag its fields
+// are added to the path of the parent struct, the same way encoding/json promotes them.
+// The conflicting names are not resolved.
+func isEmbeddedStruct(structField reflect.StructField) bool {
+	if !structField.Anonymous {
+		return false
+	}
+	t := structField.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+// hasTagName returns true if the struct field has a name on the struct tag set by SetFieldTagKey.
+func (rf *Tagger) hasTagName(structField reflect.StructField) bool {
+	tag := structField.Tag.Get(rf.fieldTagKey)
+	if idx := strings.Index(tag, ","); idx >= 0 {
+		tag = tag[:idx]
+	}
+	return tag != ""
+}
+
+// jsonNumberTaggerRuns returns the runs of the int taggers if the number is integral
+// and the runs of the float taggers otherwise. If jsonNumbersAsFloat is set the runs
+// of the float taggers are always returned.
+func (rf *Tagger) jsonNumberTaggerRuns(num json.Number) ([]taggerRun, error) {
+	if !rf.jsonNumbersAsFloat {
+		if i, err := num.Int64(); err == nil {
+			return rf.intTaggerRuns(i), nil
+		}
+	}
+
+	f, err := num.Float64()
+	if err != nil {
+		return nil, fmt.Errorf("invalid json number %q: %w", num, err)
+	}
+
+	if !rf.jsonNumbersAsFloat && f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+		return rf.intTaggerRuns(int64(f)), nil
+	}
+	return rf.floatTaggerRuns(f), nil
+}
+
+// stringTaggerRuns returns the runs of all taggers of the type string for the given data
+func (rf *Tagger) stringTaggerRuns(data string) (runs []taggerRun) {
+	for _, extractor := range rf.stringTaggers {
+		extractor := extractor
+		runs = append(runs, func(ctx context.Context) (string, *TaggerInfo, error) {
+			if !extractor.IsValid(data) {
+				return "", nil, nil
 			}
-			extractorInfoByTaggerName[extractor.GetName()] = TaggerInfo{
-				Tags:    tags,
-				RunData: runData,
+			tags, runData, err := extractor.GetTagsContext(ctx, data)
+			if err != nil {
+				return "", nil, err
 			}
-		}
+			return extractor.GetName(), &TaggerInfo{Tags: tags, RunData: runData}, nil
+		})
 	}
 	return
 }
 
-// handleFloatTaggers hander of taggers of the type int
-func (rf *Tagger) handleIntTaggers(
-	data int64,
-) (extractorInfoByTaggerName map[string]TaggerInfo, err error) {
-	extractorInfoByTaggerName = make(map[string]TaggerInfo)
-
+// intTaggerRuns returns the runs of all taggers of the type int for the given data
+func (rf *Tagger) intTaggerRuns(data int64) (runs []taggerRun) {
 	for _, extractor := range rf.intTaggers {
-		if extractor.IsValid(data) {
-			tags, runData, err := extractor.GetTags(data)
-			if err != nil {
-				return nil, err
+		extractor := extractor
+		runs = append(runs, func(ctx context.Context) (string, *TaggerInfo, error) {
+			if !extractor.IsValid(data) {
+				return "", nil, nil
 			}
-			extractorInfoByTaggerName[extractor.GetName()] = TaggerInfo{
-				Tags:    tags,
-				RunData: runData,
+			tags, runData, err := extractor.GetTagsContext(ctx, data)
+			if err != nil {
+				return "", nil, err
 			}
-		}
+			return extractor.GetName(), &TaggerInfo{Tags: tags, RunData: runData}, nil
+		})
 	}
 	return
 }
 
-// handleFloatTaggers hander of taggers of the type string
-func (rf *Tagger) handleStringTaggers(
-	data string,
-) (extractorInfoByTaggerName map[string]TaggerInfo, err error) {
-	extractorInfoByTaggerName = make(map[string]TaggerInfo)
-
-	for _, extractor := range rf.stringTaggers {
-		if extractor.IsValid(data) {
-			tags, runData, err := extractor.GetTags(data)
+// floatTaggerRuns returns the runs of all taggers of the type float for the given data
+func (rf *Tagger) floatTaggerRuns(data float64) (runs []taggerRun) {
+	for _, extractor := range rf.floatTaggers {
+		extractor := extractor
+		runs = append(runs, func(ctx context.Context) (string, *TaggerInfo, error) {
+			if !extractor.IsValid(data) {
+				return "", nil, nil
+			}
+			tags, runData, err := extractor.GetTagsContext(ctx, data)
 			if err != nil {
-				return nil, err
+				return "", nil, err
+			}
+			return extractor.GetName(), &TaggerInfo{Tags: tags, RunData: runData}, nil
+		})
+	}
+	return
+}
+
+// boolTaggerRuns returns the runs of all taggers of the type bool for the given data
+func (rf *Tagger) boolTaggerRuns(data bool) (runs []taggerRun) {
+	for _, extractor := range rf.boolTaggers {
+		extractor := extractor
+		runs = append(runs, func(ctx context.Context) (string, *TaggerInfo, error) {
+			if !extractor.IsValid(data) {
+				return "", nil, nil
 			}
-			extractorInfoByTaggerName[extractor.GetName()] = TaggerInfo{
-				Tags:    tags,
-				RunData: runData,
+			tags, runData, err := extractor.GetTagsContext(ctx, data)
+			if err != nil {
+				return "", nil, err
 			}
-		}
+			return extractor.GetName(), &TaggerInfo{Tags: tags, RunData: runData}, nil
+		})
 	}
 	return
 }
 
-// isValidateFieldPath returns true if the field path is valid for tagging
-func isValidateFieldPath(fieldPath string, includePaths []string, excludePaths []string) bool {
-	if len(excludePaths) > 0 {
-		for _, excP := range excludePaths {
-			if strings.HasPrefix(fieldPath, excP) {
+// fieldPathFilter selects the field paths that are tagged using the include and exclude
+// paths. They are matched like the field paths of the expressions, using the given
+// matching for the plain paths.
+type fieldPathFilter struct {
+	includePaths []string
+	excludePaths []string
+	matching     dsl.FieldPathMatching
+	fieldPaths   dsl.FieldPathMatchers
+}
+
+// newFieldPathFilter returns the fieldPathFilter of the include and exclude paths with
+// their glob and regex field paths compiled, so they are compiled once for each tagging.
+func newFieldPathFilter(
+	includePaths []string,
+	excludePaths []string,
+	matching dsl.FieldPathMatching,
+) *fieldPathFilter {
+	patterns := append(append([]string(nil), includePaths...), excludePaths...)
+	return &fieldPathFilter{
+		includePaths: includePaths,
+		excludePaths: excludePaths,
+		matching:     matching,
+		fieldPaths:   dsl.CompileFieldPaths(patterns),
+	}
+}
+
+// isValid returns true if the field path is valid for tagging.
+func (fpf *fieldPathFilter) isValid(fieldPath string) bool {
+	if len(fpf.excludePaths) > 0 {
+		for _, excP := range fpf.excludePaths {
+			if fpf.fieldPaths.Match(fpf.matching, excP, fieldPath) {
 				return false
 			}
 		}
 	}
 
-	if len(includePaths) > 0 {
-		for _, incP := range includePaths {
-			if strings.HasPrefix(fieldPath, incP) {
+	if len(fpf.includePaths) > 0 {
+		for _, incP := range fpf.includePaths {
+			if fpf.fieldPaths.Match(fpf.matching, incP, fieldPath) {
 				return true
 			}
 		}
@@ -3,16 +3,18 @@ package tagger
 import (
 	"testing"
 
+	"github.com/pedroegsilva/gotagthem/dsl"
 	"github.com/stretchr/testify/assert"
 )
 
-func Test_isValidateFieldPath(t *testing.T) {
+func Test_fieldPathFilter(t *testing.T) {
 	assert := assert.New(t)
 
 	type args struct {
 		fieldPath    string
 		includePaths []string
 		excludePaths []string
+		matching     dsl.FieldPathMatching
 	}
 	tests := []struct {
 		args     args
@@ -91,9 +93,74 @@ func Test_isValidateFieldPath(t *testing.T) {
 			expected: false,
 			message:  "exclude and include partial match",
 		},
+		{
+			args: args{
+				fieldPath:    "items.index(3).name",
+				includePaths: []string{"items.index(*)"},
+				excludePaths: []string{},
+			},
+			expected: true,
+			message:  "include glob",
+		},
+		{
+			args: args{
+				fieldPath:    "user.password",
+				includePaths: []string{"user"},
+				excludePaths: []string{"**.password"},
+			},
+			expected: false,
+			message:  "exclude glob",
+		},
+		{
+			args: args{
+				fieldPath:    "user.token",
+				includePaths: []string{},
+				excludePaths: []string{"/(password|token)$/"},
+			},
+			expected: false,
+			message:  "exclude regex",
+		},
+		{
+			args: args{
+				fieldPath:    "username",
+				includePaths: []string{"user"},
+				excludePaths: []string{},
+			},
+			expected: false,
+			message:  "include same prefix other segment",
+		},
+		{
+			args: args{
+				fieldPath:    "username",
+				includePaths: []string{"user"},
+				excludePaths: []string{},
+				matching:     dsl.PrefixMatching,
+			},
+			expected: true,
+			message:  "include same prefix with prefix matching",
+		},
+		{
+			args: args{
+				fieldPath:    "user.index(10)",
+				includePaths: []string{},
+				excludePaths: []string{"user.index(1"},
+			},
+			expected: true,
+			message:  "exclude partial segment",
+		},
+		{
+			args: args{
+				fieldPath:    "user.index(10)",
+				includePaths: []string{},
+				excludePaths: []string{"user.index(1"},
+				matching:     dsl.PrefixMatching,
+			},
+			expected: false,
+			message:  "exclude partial segment with prefix matching",
+		},
 	}
 	for _, tc := range tests {
-		res := isValidateFieldPath(tc.args.fieldPath, tc.args.includePaths, tc.args.excludePaths)
+		res := newFieldPathFilter(tc.args.includePaths, tc.args.excludePaths, tc.args.matching).isValid(tc.args.fieldPath)
 		assert.Equal(tc.expected, res, tc.message)
 	}
 }
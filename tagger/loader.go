@@ -0,0 +1,219 @@
+package tagger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RuleFormat is the format of a rule file.
+type RuleFormat int
+
+const (
+	JsonRuleFormat RuleFormat = iota
+	YamlRuleFormat
+)
+
+// RuleMetadata stores the information of a rule that is not used on its evaluation.
+type RuleMetadata struct {
+	Description string
+	Severity    string
+	Owner       string
+	Labels      map[string]string
+}
+
+// RuleDefinition is a rule read from a rule file. Rules without
+// the enabled flag are enabled.
+type RuleDefinition struct {
+	Name        string            `json:"name" yaml:"name"`
+	Expressions []string          `json:"expressions" yaml:"expressions"`
+	Description string            `json:"description,omitempty" yaml:"description,omitempty"`
+	Severity    string            `json:"severity,omitempty" yaml:"severity,omitempty"`
+	Owner       string            `json:"owner,omitempty" yaml:"owner,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Enabled     *bool             `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+}
+
+// IsEnabled returns false only if the rule was explicitly disabled.
+func (rd RuleDefinition) IsEnabled() bool {
+	return rd.Enabled == nil || *rd.Enabled
+}
+
+// Metadata returns the metadata of the rule.
+func (rd RuleDefinition) Metadata() RuleMetadata {
+	return RuleMetadata{
+		Description: rd.Description,
+		Severity:    rd.Severity,
+		Owner:       rd.Owner,
+		Labels:      rd.Labels,
+	}
+}
+
+// ruleFile is the content of a rule file.
+type ruleFile struct {
+	Rules []RuleDefinition `json:"rules" yaml:"rules"`
+}
+
+// DuplicateRulesError is the error returned when the same rule name
+// is found on more than one rule file.
+type DuplicateRulesError struct {
+	FilesByRuleName map[string][]string
+}
+
+// Error returns the duplicated rule names and the files where they were found.
+func (dre *DuplicateRulesError) Error() string {
+	names := make([]string, 0, len(dre.FilesByRuleName))
+	for name := range dre.FilesByRuleName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	msgs := make([]string, 0, len(names))
+	for _, name := range names {
+		msgs = append(msgs, fmt.Sprintf("%q (%s)", name, strings.Join(dre.FilesByRuleName[name], ", ")))
+	}
+	return fmt.Sprintf("duplicated rules found: %s", strings.Join(msgs, "; "))
+}
+
+// DecodeRules reads the rules from r with the given format. The content must be
+// an object with the list of rules on the field "rules", eg in yaml:
+//
+//	rules:
+//	  - name: rule1
+//	    expressions:
+//	      - '"tag1" and "tag2"'
+//	    severity: high
+//
+// Unknown fields, rules without name or expressions and duplicated names are errors.
+func DecodeRules(r io.Reader, format RuleFormat) ([]RuleDefinition, error) {
+	var rf ruleFile
+	var err error
+	switch format {
+	case JsonRuleFormat:
+		dec := json.NewDecoder(r)
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&rf)
+	case YamlRuleFormat:
+		dec := yaml.NewDecoder(r)
+		dec.KnownFields(true)
+		err = dec.Decode(&rf)
+	default:
+		return nil, fmt.Errorf("unknown rule format %d", format)
+	}
+	// an empty file has no rules
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	names := make(map[string]struct{}, len(rf.Rules))
+	for i, rd := range rf.Rules {
+		if rd.Name == "" {
+			return nil, fmt.Errorf("rule %d does not have a name", i)
+		}
+		if len(rd.Expressions) == 0 {
+			return nil, fmt.Errorf("rule %q does not have expressions", rd.Name)
+		}
+		if _, ok := names[rd.Name]; ok {
+			return nil, fmt.Errorf("rule %q is duplicated", rd.Name)
+		}
+		names[rd.Name] = struct{}{}
+	}
+	return rf.Rules, nil
+}
+
+// LoadRulesFile reads the rules of the file on the given path. The format
+// is defined by the extension of the file: ".json", ".yaml" or ".yml".
+// See DecodeRules for more information.
+func LoadRulesFile(path string) ([]RuleDefinition, error) {
+	format, ok := ruleFormatByExt(path)
+	if !ok {
+		return nil, fmt.Errorf("%s: unknown rule file extension", path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rules, err := DecodeRules(f, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// LoadRulesDir reads and merges the rules of all the rule files (see LoadRulesFile)
+// on the given directory, files with other extensions and sub directories are ignored.
+// The rules are returned in the order of the file names. If a rule name is found on
+// more than one file a DuplicateRulesError is returned.
+func LoadRulesDir(dir string) ([]RuleDefinition, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []RuleDefinition
+	filesByRuleName := make(map[string][]string)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if _, ok := ruleFormatByExt(entry.Name()); !ok {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		fileRules, err := LoadRulesFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, rd := range fileRules {
+			filesByRuleName[rd.Name] = append(filesByRuleName[rd.Name], path)
+		}
+		rules = append(rules, fileRules...)
+	}
+
+	duplicated := make(map[string][]string)
+	for name, files := range filesByRuleName {
+		if len(files) > 1 {
+			duplicated[name] = files
+		}
+	}
+	if len(duplicated) > 0 {
+		return nil, &DuplicateRulesError{FilesByRuleName: duplicated}
+	}
+	return rules, nil
+}
+
+// ruleFormatByExt returns the rule format of the file by its extension.
+func ruleFormatByExt(path string) (RuleFormat, bool) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return JsonRuleFormat, true
+	case ".yaml", ".yml":
+		return YamlRuleFormat, true
+	default:
+		return 0, false
+	}
+}
+
+// enabledRules returns the expressions and the metadata of the enabled rules.
+func enabledRules(rules []RuleDefinition) (map[string][]string, map[string]RuleMetadata) {
+	rulesByName := make(map[string][]string, len(rules))
+	metadataByName := make(map[string]RuleMetadata, len(rules))
+	for _, rd := range rules {
+		if !rd.IsEnabled() {
+			continue
+		}
+		rulesByName[rd.Name] = rd.Expressions
+		metadataByName[rd.Name] = rd.Metadata()
+	}
+	return rulesByName, metadataByName
+}
@@ -0,0 +1,221 @@
+package tagger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func TestDecodeRules(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		content       string
+		format        RuleFormat
+		expectedRules []RuleDefinition
+		expectedErr   string
+		message       string
+	}{
+		{
+			content: `
+rules:
+  - name: rule1
+    expressions:
+      - '"tag1" and "tag2"'
+      - '"tag3:field1"'
+    description: some description
+    severity: high
+    owner: some team
+    labels:
+      team: security
+  - name: rule2
+    expressions: ['"tag4"']
+    enabled: false
+`,
+			format: YamlRuleFormat,
+			expectedRules: []RuleDefinition{
+				{
+					Name:        "rule1",
+					Expressions: []string{`"tag1" and "tag2"`, `"tag3:field1"`},
+					Description: "some description",
+					Severity:    "high",
+					Owner:       "some team",
+					Labels:      map[string]string{"team": "security"},
+				},
+				{
+					Name:        "rule2",
+					Expressions: []string{`"tag4"`},
+					Enabled:     boolPtr(false),
+				},
+			},
+			message: "yaml rules",
+		},
+		{
+			content: `{"rules": [
+				{"name": "rule1", "expressions": ["\"tag1\""], "severity": "low", "enabled": true}
+			]}`,
+			format: JsonRuleFormat,
+			expectedRules: []RuleDefinition{
+				{
+					Name:        "rule1",
+					Expressions: []string{`"tag1"`},
+					Severity:    "low",
+					Enabled:     boolPtr(true),
+				},
+			},
+			message: "json rules",
+		},
+		{
+			content:       ``,
+			format:        YamlRuleFormat,
+			expectedRules: nil,
+			message:       "empty file",
+		},
+		{
+			content:     `{"rules": [{"name": "rule1", "expresions": ["\"tag1\""]}]}`,
+			format:      JsonRuleFormat,
+			expectedErr: `json: unknown field "expresions"`,
+			message:     "unknown field",
+		},
+		{
+			content:     "rules:\n  - expressions: ['\"tag1\"']\n",
+			format:      YamlRuleFormat,
+			expectedErr: "rule 0 does not have a name",
+			message:     "rule without name",
+		},
+		{
+			content:     "rules:\n  - name: rule1\n",
+			format:      YamlRuleFormat,
+			expectedErr: `rule "rule1" does not have expressions`,
+			message:     "rule without expressions",
+		},
+		{
+			content:     "rules:\n  - name: rule1\n    expressions: ['\"tag1\"']\n  - name: rule1\n    expressions: ['\"tag2\"']\n",
+			format:      YamlRuleFormat,
+			expectedErr: `rule "rule1" is duplicated`,
+			message:     "duplicated rule",
+		},
+		{
+			content:     `{}`,
+			format:      RuleFormat(42),
+			expectedErr: "unknown rule format 42",
+			message:     "unknown format",
+		},
+	}
+
+	for _, tc := range tests {
+		rules, err := DecodeRules(strings.NewReader(tc.content), tc.format)
+		if tc.expectedErr != "" {
+			assert.EqualError(err, tc.expectedErr, tc.message)
+			continue
+		}
+		assert.Nil(err, tc.message)
+		assert.Equal(tc.expectedRules, rules, tc.message)
+	}
+}
+
+func TestLoadRulesDir(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.yaml":    "rules:\n  - name: rule1\n    expressions: ['\"tag1\"']\n",
+		"b.json":    `{"rules": [{"name": "rule2", "expressions": ["\"tag2\""]}]}`,
+		"c.yml":     "rules:\n  - name: rule3\n    expressions: ['\"tag3\"']\n",
+		"README.md": "not a rule file",
+	}
+	for name, content := range files {
+		assert.Nil(os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600), name)
+	}
+	assert.Nil(os.Mkdir(filepath.Join(dir, "subdir"), 0o700), "subdir")
+
+	rules, err := LoadRulesDir(dir)
+	assert.Nil(err, "load dir")
+	assert.Equal([]RuleDefinition{
+		{Name: "rule1", Expressions: []string{`"tag1"`}},
+		{Name: "rule2", Expressions: []string{`"tag2"`}},
+		{Name: "rule3", Expressions: []string{`"tag3"`}},
+	}, rules, "load dir")
+
+	dupFile := filepath.Join(dir, "d.json")
+	assert.Nil(os.WriteFile(dupFile, []byte(`{"rules": [{"name": "rule1", "expressions": ["\"tag4\""]}]}`), 0o600))
+	rules, err = LoadRulesDir(dir)
+	assert.Nil(rules, "duplicated rules")
+	assert.Equal(&DuplicateRulesError{
+		FilesByRuleName: map[string][]string{
+			"rule1": {filepath.Join(dir, "a.yaml"), dupFile},
+		},
+	}, err, "duplicated rules")
+	assert.Equal(
+		fmt.Sprintf(`duplicated rules found: "rule1" (%s, %s)`, filepath.Join(dir, "a.yaml"), dupFile),
+		err.Error(),
+		"duplicated rules message",
+	)
+
+	invalidFile := filepath.Join(dir, "d.json")
+	assert.Nil(os.WriteFile(invalidFile, []byte(`{"rules": [{"name": "rule4"}]}`), 0o600))
+	_, err = LoadRulesDir(dir)
+	assert.EqualError(err, invalidFile+`: rule "rule4" does not have expressions`, "invalid file")
+
+	_, err = LoadRulesFile(filepath.Join(dir, "README.md"))
+	assert.EqualError(err, filepath.Join(dir, "README.md")+": unknown rule file extension", "unknown extension")
+}
+
+func TestAddRuleDefinitions(t *testing.T) {
+	assert := assert.New(t)
+	tagger := NewTagger(nil, nil, nil)
+	err := tagger.AddRuleDefinitions([]RuleDefinition{
+		{
+			Name:        "rule1",
+			Expressions: []string{`"tag1"`},
+			Description: "some description",
+			Severity:    "high",
+			Owner:       "some team",
+		},
+		{
+			Name:        "rule2",
+			Expressions: []string{`"tag2"`},
+			Enabled:     boolPtr(false),
+		},
+		{
+			Name:        "rule3",
+			Expressions: []string{`"tag3"`},
+			Enabled:     boolPtr(true),
+		},
+	})
+	assert.Nil(err, "add rule definitions")
+	assert.Equal(map[string]int{"tag1": 1, "tag3": 1}, tagger.loadRules().tags, "disabled rules are skipped")
+
+	metadata, ok := tagger.GetRuleMetadata("rule1")
+	assert.True(ok, "rule1 metadata")
+	assert.Equal(RuleMetadata{Description: "some description", Severity: "high", Owner: "some team"}, metadata, "rule1 metadata")
+	_, ok = tagger.GetRuleMetadata("rule2")
+	assert.False(ok, "disabled rule metadata")
+
+	tagger.RemoveRule("rule1")
+	_, ok = tagger.GetRuleMetadata("rule1")
+	assert.False(ok, "removed rule metadata")
+
+	err = tagger.ReloadRuleDefinitions([]RuleDefinition{
+		{Name: "rule4", Expressions: []string{`"tag4`}},
+	})
+	assert.IsType(RuleErrors{}, err, "reload invalid rule definitions")
+	_, ok = tagger.GetRuleMetadata("rule3")
+	assert.True(ok, "rules are kept after invalid reload")
+
+	err = tagger.ReloadRuleDefinitions([]RuleDefinition{
+		{Name: "rule4", Expressions: []string{`"tag4"`}, Severity: "low"},
+	})
+	assert.Nil(err, "reload rule definitions")
+	assert.Equal(map[string]int{"tag4": 1}, tagger.loadRules().tags, "reload rule definitions")
+	_, ok = tagger.GetRuleMetadata("rule3")
+	assert.False(ok, "reloaded rules metadata")
+	metadata, _ = tagger.GetRuleMetadata("rule4")
+	assert.Equal(RuleMetadata{Severity: "low"}, metadata, "reloaded rules metadata")
+}
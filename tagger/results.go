@@ -0,0 +1,105 @@
+package tagger
+
+import (
+	"sort"
+
+	"github.com/pedroegsilva/gotagthem/dsl"
+)
+
+// TagMatch is a tag and the field path where it was found.
+type TagMatch struct {
+	Tag       string
+	FieldPath string
+}
+
+// RuleResult is an expression of a rule that was evaluated as true.
+// Matches are the tags and field paths that made the expression true,
+// negated tags are not included since they are true by their absence.
+// Explanation has the value of each node of the expression.
+type RuleResult struct {
+	RuleName        string
+	ExpressionIndex int
+	Expression      ExpressionWrapper
+	Metadata        RuleMetadata
+	Matches         []TagMatch
+	Explanation     *dsl.Explanation
+}
+
+// EvaluateRulesDetailed is the same as EvaluateRules but it returns a RuleResult
+// for each expression evaluated as true, sorted by rule name and expression index.
+func (rf *Tagger) EvaluateRulesDetailed(fieldsByTag map[string][]string) ([]RuleResult, error) {
+	rs := rf.loadRules()
+	index := rs.getIndex()
+	var results []RuleResult
+	err := index.evaluate(fieldsByTag, func(id int, firedRules map[string]bool) (bool, error) {
+		ie := index.exprs[id]
+		expl, err := ie.ew.Expression.ExplainWithOptions(fieldsByTag, dsl.SolveOptions{
+			Matching:   rf.fieldPathMatching,
+			FieldPaths: index.fieldPaths,
+			FiredRules: firedRules,
+		})
+		if err != nil {
+			return false, err
+		}
+		if !expl.Value {
+			return false, nil
+		}
+
+		results = append(results, RuleResult{
+			RuleName:        ie.ruleName,
+			ExpressionIndex: ie.index,
+			Expression:      ie.ew,
+			Metadata:        rs.metadataByRuleName[ie.ruleName],
+			Matches:         appendMatches(nil, expl),
+			Explanation:     expl,
+		})
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the rules are evaluated after the rules that they reference
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].RuleName < results[j].RuleName
+	})
+	return results, nil
+}
+
+// appendMatches appends the unique tags and field paths that made the explained
+// expression true. For OR and ATLEAST expressions only the branches that are true
+// are followed, for SAMEPARENT only the co-located field paths are used and NOT
+// expressions are skipped.
+func appendMatches(matches []TagMatch, expl *dsl.Explanation) []TagMatch {
+	if !expl.Value {
+		return matches
+	}
+
+	switch expl.Expression.Type {
+	case dsl.UNIT_EXPR, dsl.COUNT_EXPR:
+		for _, fieldPath := range expl.MatchedFieldPaths {
+			match := TagMatch{Tag: expl.Expression.Tag.Name, FieldPath: fieldPath}
+			if !containsMatch(matches, match) {
+				matches = append(matches, match)
+			}
+		}
+	case dsl.AND_EXPR, dsl.OR_EXPR:
+		matches = appendMatches(matches, expl.LExpl)
+		matches = appendMatches(matches, expl.RExpl)
+	case dsl.ATLEAST_EXPR, dsl.SAMEPARENT_EXPR:
+		for _, operandExpl := range expl.Expls {
+			matches = appendMatches(matches, operandExpl)
+		}
+	}
+	return matches
+}
+
+// containsMatch returns true if the match is on the list.
+func containsMatch(matches []TagMatch, match TagMatch) bool {
+	for _, m := range matches {
+		if m == match {
+			return true
+		}
+	}
+	return false
+}
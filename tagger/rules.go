@@ -0,0 +1,254 @@
+package tagger
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pedroegsilva/gotagthem/dsl"
+)
+
+// RuleError is the error found when parsing one of the expressions of a rule.
+type RuleError struct {
+	RuleName        string
+	ExpressionIndex int
+	Expression      string
+	Err             error
+}
+
+// Error returns the rule name, the expression index and the parser error.
+func (re *RuleError) Error() string {
+	return fmt.Sprintf("rule %q expression %d: %s", re.RuleName, re.ExpressionIndex, re.Err)
+}
+
+// Unwrap returns the parser error.
+func (re *RuleError) Unwrap() error {
+	return re.Err
+}
+
+// RuleErrors are all the errors found when parsing a set of rules,
+// sorted by rule name and expression index.
+type RuleErrors []*RuleError
+
+// Error returns the message of all errors.
+func (res RuleErrors) Error() string {
+	msgs := make([]string, 0, len(res))
+	for _, re := range res {
+		msgs = append(msgs, re.Error())
+	}
+	return fmt.Sprintf("%d invalid expressions found: %s", len(res), strings.Join(msgs, "; "))
+}
+
+// ruleSet stores the rules of the tagger and the number of expressions that reference
+// each tag and field. A ruleSet is never changed after it is stored on the tagger,
+// the changes are made on a copy that replaces it.
+// metadataByRuleName is only created when a rule with metadata is added and
+// the index is built on the first evaluation of the rules.
+type ruleSet struct {
+	expressionWrapperByExprName map[string][]ExpressionWrapper
+	fields                      map[string]int
+	tags                        map[string]int
+	metadataByRuleName          map[string]RuleMetadata
+	index                       *ruleIndex
+	indexOnce                   sync.Once
+}
+
+// newRuleSet returns an empty ruleSet.
+func newRuleSet() *ruleSet {
+	return &ruleSet{
+		expressionWrapperByExprName: make(map[string][]ExpressionWrapper),
+		fields:                      make(map[string]int),
+		tags:                        make(map[string]int),
+	}
+}
+
+// clone returns a copy of the ruleSet that can be changed without affecting the original.
+func (rs *ruleSet) clone() *ruleSet {
+	cloned := &ruleSet{
+		expressionWrapperByExprName: make(map[string][]ExpressionWrapper, len(rs.expressionWrapperByExprName)),
+		fields:                      make(map[string]int, len(rs.fields)),
+		tags:                        make(map[string]int, len(rs.tags)),
+	}
+	for name, exprWrappers := range rs.expressionWrapperByExprName {
+		cloned.expressionWrapperByExprName[name] = append([]ExpressionWrapper(nil), exprWrappers...)
+	}
+	for field, count := range rs.fields {
+		cloned.fields[field] = count
+	}
+	for tag, count := range rs.tags {
+		cloned.tags[tag] = count
+	}
+	for name, metadata := range rs.metadataByRuleName {
+		cloned.setMetadata(name, metadata)
+	}
+	return cloned
+}
+
+// getIndex returns the index of the rules, building it on the first call.
+func (rs *ruleSet) getIndex() *ruleIndex {
+	rs.indexOnce.Do(func() {
+		rs.index = newRuleIndex(rs.expressionWrapperByExprName)
+	})
+	return rs.index
+}
+
+// setMetadata sets the metadata of the rule.
+func (rs *ruleSet) setMetadata(ruleName string, metadata RuleMetadata) {
+	if rs.metadataByRuleName == nil {
+		rs.metadataByRuleName = make(map[string]RuleMetadata)
+	}
+	rs.metadataByRuleName[ruleName] = metadata
+}
+
+// addRule parses and adds the given expressions to the rule.
+func (rs *ruleSet) addRule(ruleName string, expressions []string, leftToRight bool) error {
+	exprWrappers, err := parseExpressions(expressions, leftToRight)
+	if err != nil {
+		return err
+	}
+	rs.addExpressions(ruleName, exprWrappers)
+	return nil
+}
+
+// addExpressions adds the parsed expressions to the rule.
+func (rs *ruleSet) addExpressions(ruleName string, exprWrappers []ExpressionWrapper) {
+	for _, ew := range exprWrappers {
+		rs.addReferences(ew.Expression)
+	}
+	rs.expressionWrapperByExprName[ruleName] = append(rs.expressionWrapperByExprName[ruleName], exprWrappers...)
+}
+
+// removeRule removes the rule, its metadata and its references. Returns false if the rule was not found.
+func (rs *ruleSet) removeRule(ruleName string) bool {
+	if !rs.removeExpressions(ruleName) {
+		return false
+	}
+	delete(rs.metadataByRuleName, ruleName)
+	return true
+}
+
+// removeExpressions removes the expressions of the rule and their references, keeping
+// the metadata of the rule. Returns false if the rule was not found.
+func (rs *ruleSet) removeExpressions(ruleName string) bool {
+	exprWrappers, ok := rs.expressionWrapperByExprName[ruleName]
+	if !ok {
+		return false
+	}
+
+	for _, ew := range exprWrappers {
+		rs.removeReferences(ew.Expression)
+	}
+	delete(rs.expressionWrapperByExprName, ruleName)
+	return true
+}
+
+// addReferences counts a reference for each of the unique tags and fields of the expression.
+func (rs *ruleSet) addReferences(exp *dsl.Expression) {
+	for _, tag := range exp.GetTags() {
+		rs.tags[tag]++
+	}
+	for _, field := range exp.GetFields() {
+		rs.fields[field]++
+	}
+}
+
+// removeReferences removes a reference of each of the unique tags and fields of the
+// expression, deleting the ones that are not referenced anymore.
+func (rs *ruleSet) removeReferences(exp *dsl.Expression) {
+	for _, tag := range exp.GetTags() {
+		rs.tags[tag]--
+		if rs.tags[tag] <= 0 {
+			delete(rs.tags, tag)
+		}
+	}
+	for _, field := range exp.GetFields() {
+		rs.fields[field]--
+		if rs.fields[field] <= 0 {
+			delete(rs.fields, field)
+		}
+	}
+}
+
+// parseExpressions parses all the expressions, returning the first error found.
+// If leftToRight is set the expressions are parsed ignoring the operators precedence.
+func parseExpressions(expressions []string, leftToRight bool) ([]ExpressionWrapper, error) {
+	exprWrappers := make([]ExpressionWrapper, 0, len(expressions))
+	for _, rawExpr := range expressions {
+		exp, err := parseExpression(rawExpr, leftToRight)
+		if err != nil {
+			return nil, err
+		}
+		exprWrappers = append(exprWrappers, ExpressionWrapper{
+			ExpressionString: rawExpr,
+			Expression:       exp,
+		})
+	}
+	return exprWrappers, nil
+}
+
+// parseExpression parses the expression, see dsl.Parser.SetLeftToRight.
+func parseExpression(rawExpr string, leftToRight bool) (*dsl.Expression, error) {
+	p := dsl.NewParser(strings.NewReader(rawExpr))
+	p.SetLeftToRight(leftToRight)
+	return p.Parse()
+}
+
+// parseRules parses the expressions of all rules (key of the map). All expressions
+// are parsed even if errors are found, and if any of them is invalid a RuleErrors
+// with all the errors is returned. If leftToRight is set the expressions are parsed
+// ignoring the operators precedence.
+func parseRules(rulesByName map[string][]string, leftToRight bool) (map[string][]ExpressionWrapper, error) {
+	var ruleErrs RuleErrors
+	exprWrappersByName := make(map[string][]ExpressionWrapper, len(rulesByName))
+	for ruleName, expressions := range rulesByName {
+		exprWrappers := make([]ExpressionWrapper, 0, len(expressions))
+		for idx, rawExpr := range expressions {
+			exp, err := parseExpression(rawExpr, leftToRight)
+			if err != nil {
+				ruleErrs = append(ruleErrs, &RuleError{
+					RuleName:        ruleName,
+					ExpressionIndex: idx,
+					Expression:      rawExpr,
+					Err:             err,
+				})
+				continue
+			}
+			exprWrappers = append(exprWrappers, ExpressionWrapper{
+				ExpressionString: rawExpr,
+				Expression:       exp,
+			})
+		}
+		exprWrappersByName[ruleName] = exprWrappers
+	}
+
+	if len(ruleErrs) > 0 {
+		sort.Slice(ruleErrs, func(i, j int) bool {
+			if ruleErrs[i].RuleName != ruleErrs[j].RuleName {
+				return ruleErrs[i].RuleName < ruleErrs[j].RuleName
+			}
+			return ruleErrs[i].ExpressionIndex < ruleErrs[j].ExpressionIndex
+		})
+		return nil, ruleErrs
+	}
+	return exprWrappersByName, nil
+}
+
+// loadRules returns the current ruleSet of the tagger.
+func (rf *Tagger) loadRules() *ruleSet {
+	return rf.rules.Load().(*ruleSet)
+}
+
+// updateRules calls fn with a copy of the current ruleSet that replaces it if
+// fn does not return an error. Concurrent updates are executed one at a time.
+func (rf *Tagger) updateRules(fn func(rs *ruleSet) error) error {
+	rf.rulesMu.Lock()
+	defer rf.rulesMu.Unlock()
+
+	rs := rf.loadRules().clone()
+	if err := fn(rs); err != nil {
+		return err
+	}
+	rf.rules.Store(rs)
+	return nil
+}
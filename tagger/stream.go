@@ -0,0 +1,193 @@
+package tagger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// TagJsonReader tags the json values read from r, consuming it token by token
+// so the documents are never fully loaded on memory. The numbers are handled
+// the same way as TagJson. r can have a single json
+// document or a stream of them (eg: newline delimited json), fn is called with
+// the FieldsInfo of each document in the order that they are read.
+// The FieldsInfo of a document is only complete at its end, so a document that is a
+// huge top-level array is kept on memory until it is fully read, use SetSplitJsonArrays
+// to call fn for each element of the top-level arrays.
+// If fn returns an error the reading stops and the error is returned.
+func (rf *Tagger) TagJsonReader(
+	r io.Reader,
+	includePaths []string,
+	excludePaths []string,
+	fn func(fieldsInfo FieldsInfo) error,
+) error {
+	return rf.TagJsonReaderContext(context.Background(), r, includePaths, excludePaths, fn)
+}
+
+// TagJsonReaderContext is the same as TagJsonReader but the given context is passed to the taggers.
+func (rf *Tagger) TagJsonReaderContext(
+	ctx context.Context,
+	r io.Reader,
+	includePaths []string,
+	excludePaths []string,
+	fn func(fieldsInfo FieldsInfo) error,
+) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	filter := newFieldPathFilter(includePaths, excludePaths, rf.fieldPathMatching)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if delim, ok := tok.(json.Delim); !ok || delim != '[' || !rf.splitJsonArrays {
+			if err := rf.tagJsonDocument(ctx, dec, tok, filter, fn); err != nil {
+				return err
+			}
+			continue
+		}
+
+		for dec.More() {
+			elemTok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			if err := rf.tagJsonDocument(ctx, dec, elemTok, filter, fn); err != nil {
+				return err
+			}
+		}
+		// consumes the closing delimiter
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+	}
+
+	tok, err := dec.Token()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("unexpected json token %v", tok)
+}
+
+// ProcessJsonReader extract all tags and evaluate all rules for each json document read from r.
+// fn is called with the result of each document in the order that they are read.
+// See TagJsonReader for more information.
+func (rf *Tagger) ProcessJsonReader(
+	r io.Reader,
+	includePaths []string,
+	excludePaths []string,
+	fn func(expressionsByRule map[string][]string) error,
+) error {
+	return rf.ProcessJsonReaderContext(context.Background(), r, includePaths, excludePaths, fn)
+}
+
+// ProcessJsonReaderContext is the same as ProcessJsonReader but the given context is passed to the taggers.
+func (rf *Tagger) ProcessJsonReaderContext(
+	ctx context.Context,
+	r io.Reader,
+	includePaths []string,
+	excludePaths []string,
+	fn func(expressionsByRule map[string][]string) error,
+) error {
+	return rf.TagJsonReaderContext(ctx, r, includePaths, excludePaths, func(fieldsInfo FieldsInfo) error {
+		expressionsByRule, err := rf.EvaluateRules(fieldsInfo.GetFieldsByTag())
+		if err != nil {
+			return err
+		}
+		return fn(expressionsByRule)
+	})
+}
+
+// tagJsonDocument tags the json value that starts with tok, reading the rest of it
+// from the decoder, and calls fn with its FieldsInfo.
+func (rf *Tagger) tagJsonDocument(
+	ctx context.Context,
+	dec *json.Decoder,
+	tok json.Token,
+	filter *fieldPathFilter,
+	fn func(fieldsInfo FieldsInfo) error,
+) error {
+	fc := rf.newFieldCollector(ctx)
+	walkErr := rf.setJsonTokenFieldInfos(dec, tok, "", fc, filter)
+	fieldsInfo, err := fc.wait()
+	if walkErr != nil {
+		return walkErr
+	}
+	if err != nil {
+		return err
+	}
+	return fn(fieldsInfo)
+}
+
+// setJsonFieldInfos reads the next json value from the decoder and adds to the field
+// collector the taggers of all fields found on it.
+func (rf *Tagger) setJsonFieldInfos(
+	dec *json.Decoder,
+	fieldName string,
+	fc *fieldCollector,
+	filter *fieldPathFilter,
+) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	return rf.setJsonTokenFieldInfos(dec, tok, fieldName, fc, filter)
+}
+
+// setJsonTokenFieldInfos is the same as setJsonFieldInfos but the first token of the
+// json value was already read from the decoder.
+func (rf *Tagger) setJsonTokenFieldInfos(
+	dec *json.Decoder,
+	tok json.Token,
+	fieldName string,
+	fc *fieldCollector,
+	filter *fieldPathFilter,
+) error {
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		if tok == nil {
+			return nil
+		}
+		return rf.setFieldInfos(reflect.ValueOf(tok), fieldName, fc, filter, nil)
+	}
+
+	switch delim {
+	case '{':
+		for dec.More() {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			fn, ok := keyTok.(string)
+			if !ok {
+				return fmt.Errorf("unexpected json key %v", keyTok)
+			}
+			if fieldName != "" {
+				fn = fieldName + "." + fn
+			}
+			if err := rf.setJsonFieldInfos(dec, fn, fc, filter); err != nil {
+				return err
+			}
+		}
+
+	case '[':
+		for i := 0; dec.More(); i++ {
+			fn := fmt.Sprintf("index(%d)", i)
+			if fieldName != "" {
+				fn = fieldName + "." + fn
+			}
+			if err := rf.setJsonFieldInfos(dec, fn, fc, filter); err != nil {
+				return err
+			}
+		}
+	}
+
+	// consumes the closing delimiter
+	_, err := dec.Token()
+	return err
+}
@@ -0,0 +1,207 @@
+package tagger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTagJsonReader(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		rawJson            string
+		expectedFieldsInfo []FieldsInfo
+		expectedErr        error
+		message            string
+	}{
+		{
+			rawJson: `{"strField": "some string", "obj": {"arr": ["str", true, null]}, "nullField": null}`,
+			expectedFieldsInfo: []FieldsInfo{
+				{
+					&FieldInfo{
+						Name: "strField",
+						Taggers: map[string]TaggerInfo{
+							"emptyStrTagger": {Tags: []string{"strTag"}},
+						},
+					},
+					&FieldInfo{
+						Name: "obj.arr.index(0)",
+						Taggers: map[string]TaggerInfo{
+							"emptyStrTagger": {Tags: []string{"strTag"}},
+						},
+					},
+					&FieldInfo{
+						Name: "obj.arr.index(1)",
+						Taggers: map[string]TaggerInfo{
+							"emptyBoolTagger": {Tags: []string{"boolTag"}},
+						},
+					},
+				},
+			},
+			expectedErr: nil,
+			message:     "single document",
+		},
+		{
+			rawJson: "{\"field\": \"some string\"}\n{\"field\": 42.42}\n\"raw string\"\n",
+			expectedFieldsInfo: []FieldsInfo{
+				{
+					&FieldInfo{
+						Name: "field",
+						Taggers: map[string]TaggerInfo{
+							"emptyStrTagger": {Tags: []string{"strTag"}},
+						},
+					},
+				},
+				{
+					&FieldInfo{
+						Name: "field",
+						Taggers: map[string]TaggerInfo{
+							"emptyFloatTagger": {Tags: []string{"floatTag"}},
+						},
+					},
+				},
+				{
+					&FieldInfo{
+						Name: "",
+						Taggers: map[string]TaggerInfo{
+							"emptyStrTagger": {Tags: []string{"strTag"}},
+						},
+					},
+				},
+			},
+			expectedErr: nil,
+			message:     "newline delimited json",
+		},
+		{
+			rawJson:            ``,
+			expectedFieldsInfo: nil,
+			expectedErr:        nil,
+			message:            "empty reader",
+		},
+		{
+			rawJson:            `{"field": [`,
+			expectedFieldsInfo: nil,
+			expectedErr:        &json.SyntaxError{},
+			message:            "unclosed document",
+		},
+	}
+
+	for _, tc := range tests {
+		tagger := NewTaggerWithBool(
+			[]StringTagger{&emptyStrTagger{}},
+			[]IntTagger{&emptyIntTagger{}},
+			[]FloatTagger{&emptyFloatTagger{}},
+			[]BoolTagger{&emptyBoolTagger{}},
+		)
+		var fieldsInfos []FieldsInfo
+		err := tagger.TagJsonReader(strings.NewReader(tc.rawJson), nil, nil, func(fieldsInfo FieldsInfo) error {
+			fieldsInfos = append(fieldsInfos, fieldsInfo)
+			return nil
+		})
+		assert.IsType(tc.expectedErr, err, tc.message+" expected error")
+		assert.Equal(tc.expectedFieldsInfo, fieldsInfos, tc.message+" result")
+	}
+}
+
+func TestTagJsonReaderSplitArrays(t *testing.T) {
+	assert := assert.New(t)
+	rawJson := "[{\"field\": \"some string\"}, 42.42, [true]]\n{\"field\": \"some string\"}\n"
+	tests := []struct {
+		split               bool
+		expectedFieldsByTag []map[string][]string
+		message             string
+	}{
+		{
+			split: false,
+			expectedFieldsByTag: []map[string][]string{
+				{
+					"strTag":   {"index(0).field"},
+					"floatTag": {"index(1)"},
+					"boolTag":  {"index(2).index(0)"},
+				},
+				{"strTag": {"field"}},
+			},
+			message: "array as a single document",
+		},
+		{
+			split: true,
+			expectedFieldsByTag: []map[string][]string{
+				{"strTag": {"field"}},
+				{"floatTag": {""}},
+				{"boolTag": {"index(0)"}},
+				{"strTag": {"field"}},
+			},
+			message: "elements of the array as documents",
+		},
+	}
+
+	for _, tc := range tests {
+		tagger := NewTaggerWithBool(
+			[]StringTagger{&emptyStrTagger{}},
+			[]IntTagger{&emptyIntTagger{}},
+			[]FloatTagger{&emptyFloatTagger{}},
+			[]BoolTagger{&emptyBoolTagger{}},
+		)
+		tagger.SetSplitJsonArrays(tc.split)
+		var fieldsByTag []map[string][]string
+		err := tagger.TagJsonReader(strings.NewReader(rawJson), nil, nil, func(fieldsInfo FieldsInfo) error {
+			fieldsByTag = append(fieldsByTag, fieldsInfo.GetFieldsByTag())
+			return nil
+		})
+		assert.Nil(err, tc.message+" expected error")
+		assert.Equal(tc.expectedFieldsByTag, fieldsByTag, tc.message+" result")
+	}
+
+	// the elements are tagged as soon as they are read
+	tagger := NewTagger([]StringTagger{&emptyStrTagger{}}, nil, nil)
+	tagger.SetSplitJsonArrays(true)
+	r := io.MultiReader(strings.NewReader(`[{"field": "some string"}, `), iotest.ErrReader(fmt.Errorf("read error")))
+	count := 0
+	err := tagger.TagJsonReader(r, nil, nil, func(fieldsInfo FieldsInfo) error {
+		count++
+		return nil
+	})
+	assert.Equal(fmt.Errorf("read error"), err, "read error")
+	assert.Equal(1, count, "elements read before the error")
+}
+
+func TestProcessJsonReader(t *testing.T) {
+	assert := assert.New(t)
+	tagger, err := NewTaggerWithRules(
+		[]StringTagger{&emptyStrTagger{}},
+		[]IntTagger{&emptyIntTagger{}},
+		[]FloatTagger{&emptyFloatTagger{}},
+		map[string][]string{
+			"rule1": {`"strTag:user"`},
+			"rule2": {`"floatTag"`},
+			"rule3": {`"intTag:user"`},
+		},
+	)
+	assert.Nil(err, "new tagger expected error")
+
+	rawJson := "{\"user\": {\"name\": \"some name\"}}\n{\"height\": 1.8}\n{\"user\": {\"age\": 42}}\n"
+	var results []map[string][]string
+	err = tagger.ProcessJsonReader(strings.NewReader(rawJson), nil, nil, func(expressionsByRule map[string][]string) error {
+		results = append(results, expressionsByRule)
+		return nil
+	})
+	assert.Nil(err, "process json reader expected error")
+	assert.Equal([]map[string][]string{
+		{"rule1": {`"strTag:user"`}},
+		{"rule2": {`"floatTag"`}},
+		{"rule3": {`"intTag:user"`}},
+	}, results, "process json reader result")
+
+	count := 0
+	err = tagger.ProcessJsonReader(strings.NewReader(rawJson), nil, nil, func(expressionsByRule map[string][]string) error {
+		count++
+		return fmt.Errorf("stop")
+	})
+	assert.Equal(fmt.Errorf("stop"), err, "callback error")
+	assert.Equal(1, count, "callback error calls")
+}
@@ -1,8 +1,14 @@
 package tagger
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/pedroegsilva/gotagthem/dsl"
 )
@@ -28,14 +34,31 @@ type FloatTagger interface {
 	GetName() string
 }
 
-// Tagger stores all values needed for the tagger
+// BoolTagger interface of a tagger that process booleans
+type BoolTagger interface {
+	IsValid(data bool) bool
+	GetTags(data bool) (tags []string, runData interface{}, err error)
+	GetName() string
+}
+
+// Tagger stores all values needed for the tagger.
+// The rules can be added, removed and reloaded while the tagger is used
+// concurrently, each tagging and evaluation uses the rules that were set
+// when it started. The taggers and the settings must not be changed after
+// the tagger starts to be used.
 type Tagger struct {
-	stringTaggers               []StringTagger
-	intTaggers                  []IntTagger
-	floatTaggers                []FloatTagger
-	expressionWrapperByExprName map[string][]ExpressionWrapper
-	fields                      map[string]struct{}
-	tags                        map[string]struct{}
+	stringTaggers      []StringContextTagger
+	intTaggers         []IntContextTagger
+	floatTaggers       []FloatContextTagger
+	boolTaggers        []BoolContextTagger
+	rules              atomic.Value // *ruleSet
+	rulesMu            sync.Mutex
+	fieldTagKey        string
+	workers            int
+	jsonNumbersAsFloat bool
+	fieldPathMatching  dsl.FieldPathMatching
+	leftToRight        bool
+	splitJsonArrays    bool
 }
 
 // TaggerInfo stores the information generated by the taggers
@@ -65,14 +88,41 @@ func NewTagger(
 	intTaggers []IntTagger,
 	floatTaggers []FloatTagger,
 ) *Tagger {
-	return &Tagger{
-		stringTaggers:               stringTaggers,
-		intTaggers:                  intTaggers,
-		floatTaggers:                floatTaggers,
-		expressionWrapperByExprName: make(map[string][]ExpressionWrapper),
-		fields:                      make(map[string]struct{}),
-		tags:                        make(map[string]struct{}),
+	return NewTaggerWithBool(stringTaggers, intTaggers, floatTaggers, nil)
+}
+
+// NewTaggerWithBool returns initialized instancy of Tagger with the given taggers,
+// including the taggers of booleans.
+func NewTaggerWithBool(
+	stringTaggers []StringTagger,
+	intTaggers []IntTagger,
+	floatTaggers []FloatTagger,
+	boolTaggers []BoolTagger,
+) *Tagger {
+	return NewContextTagger(
+		adaptStringTaggers(stringTaggers),
+		adaptIntTaggers(intTaggers),
+		adaptFloatTaggers(floatTaggers),
+		adaptBoolTaggers(boolTaggers),
+	)
+}
+
+// NewContextTagger returns initialized instancy of Tagger with the given taggers
+// that receive the context of the Context methods.
+func NewContextTagger(
+	stringTaggers []StringContextTagger,
+	intTaggers []IntContextTagger,
+	floatTaggers []FloatContextTagger,
+	boolTaggers []BoolContextTagger,
+) *Tagger {
+	tagger := &Tagger{
+		stringTaggers: stringTaggers,
+		intTaggers:    intTaggers,
+		floatTaggers:  floatTaggers,
+		boolTaggers:   boolTaggers,
 	}
+	tagger.rules.Store(newRuleSet())
+	return tagger
 }
 
 // NewTagger returns initialized instancy of Tagger with the given taggers and rules.
@@ -87,98 +137,332 @@ func NewTaggerWithRules(
 	return
 }
 
+// NewTaggerWithBoolAndRules returns initialized instancy of Tagger with the given taggers,
+// including the taggers of booleans, and rules.
+func NewTaggerWithBoolAndRules(
+	stringTaggers []StringTagger,
+	intTaggers []IntTagger,
+	floatTaggers []FloatTagger,
+	boolTaggers []BoolTagger,
+	rulesByName map[string][]string,
+) (tagger *Tagger, err error) {
+	tagger = NewTaggerWithBool(stringTaggers, intTaggers, floatTaggers, boolTaggers)
+	err = tagger.AddRules(rulesByName)
+	return
+}
+
+// NewContextTaggerWithRules returns initialized instancy of Tagger with the given
+// context taggers and rules.
+func NewContextTaggerWithRules(
+	stringTaggers []StringContextTagger,
+	intTaggers []IntContextTagger,
+	floatTaggers []FloatContextTagger,
+	boolTaggers []BoolContextTagger,
+	rulesByName map[string][]string,
+) (tagger *Tagger, err error) {
+	tagger = NewContextTagger(stringTaggers, intTaggers, floatTaggers, boolTaggers)
+	err = tagger.AddRules(rulesByName)
+	return
+}
+
 // AddRule adds the given expressions with the rule name to the tagger.
+// If any of the expressions is invalid, references a rule that does not exist
+// (UndefinedRuleError) or creates a cycle of rule references (RuleCycleError)
+// the error is returned and the tagger is not changed.
 func (rf *Tagger) AddRule(ruleName string, expressions []string) error {
-	for _, rawExpr := range expressions {
-		p := dsl.NewParser(strings.NewReader(rawExpr))
-		exp, err := p.Parse()
-		if err != nil {
+	return rf.updateRules(func(rs *ruleSet) error {
+		if err := rs.addRule(ruleName, expressions, rf.leftToRight); err != nil {
 			return err
 		}
-		expWrapper := ExpressionWrapper{
-			ExpressionString: rawExpr,
-			Expression:       exp,
-		}
-		rf.expressionWrapperByExprName[ruleName] = append(rf.expressionWrapperByExprName[ruleName], expWrapper)
-		for _, tag := range p.GetTags() {
-			rf.tags[tag] = struct{}{}
+		return rs.checkRuleReferences([]string{ruleName})
+	})
+}
+
+// AddRule adds the given expressions with the rule names (key of the map) to the tagger.
+// All expressions are parsed before any rule is added, if any of them is invalid a
+// RuleErrors with the errors of all invalid expressions is returned and the tagger
+// is not changed. The rules can reference the other rules of the map and the rules
+// of the tagger, see AddRule for the errors of the references.
+func (rf *Tagger) AddRules(rulesByName map[string][]string) error {
+	return rf.addRules(rulesByName, nil)
+}
+
+// ReloadRules replaces all the rules of the tagger by the given rules (key of the map).
+// All expressions are parsed before the replacement, if any of them is invalid a
+// RuleErrors with the errors of all invalid expressions is returned and the current
+// rules are kept. The rules can only reference the other rules of the map.
+func (rf *Tagger) ReloadRules(rulesByName map[string][]string) error {
+	return rf.reloadRules(rulesByName, nil)
+}
+
+// AddRuleDefinitions adds the enabled rules (eg: read by LoadRulesDir) and their
+// metadata to the tagger, the disabled rules are skipped. See AddRules for more information.
+func (rf *Tagger) AddRuleDefinitions(rules []RuleDefinition) error {
+	return rf.addRules(enabledRules(rules))
+}
+
+// ReloadRuleDefinitions replaces all the rules of the tagger by the enabled rules
+// (eg: read by LoadRulesDir), the disabled rules are skipped. See ReloadRules for
+// more information.
+func (rf *Tagger) ReloadRuleDefinitions(rules []RuleDefinition) error {
+	return rf.reloadRules(enabledRules(rules))
+}
+
+// GetRuleMetadata returns the metadata of the rule.
+// ok is false if the rule does not have metadata.
+func (rf *Tagger) GetRuleMetadata(ruleName string) (metadata RuleMetadata, ok bool) {
+	metadata, ok = rf.loadRules().metadataByRuleName[ruleName]
+	return
+}
+
+// addRules parses and adds the rules and their metadata.
+func (rf *Tagger) addRules(rulesByName map[string][]string, metadataByName map[string]RuleMetadata) error {
+	exprWrappersByName, err := parseRules(rulesByName, rf.leftToRight)
+	if err != nil {
+		return err
+	}
+
+	return rf.updateRules(func(rs *ruleSet) error {
+		ruleNames := make([]string, 0, len(exprWrappersByName))
+		for ruleName, exprWrappers := range exprWrappersByName {
+			rs.addExpressions(ruleName, exprWrappers)
+			ruleNames = append(ruleNames, ruleName)
 		}
-		for _, field := range p.GetFields() {
-			rf.fields[field] = struct{}{}
+		for ruleName, metadata := range metadataByName {
+			rs.setMetadata(ruleName, metadata)
 		}
+		return rs.checkRuleReferences(ruleNames)
+	})
+}
+
+// reloadRules parses the rules and replaces the current rules by them.
+func (rf *Tagger) reloadRules(rulesByName map[string][]string, metadataByName map[string]RuleMetadata) error {
+	exprWrappersByName, err := parseRules(rulesByName, rf.leftToRight)
+	if err != nil {
+		return err
+	}
+
+	rs := newRuleSet()
+	ruleNames := make([]string, 0, len(exprWrappersByName))
+	for ruleName, exprWrappers := range exprWrappersByName {
+		rs.addExpressions(ruleName, exprWrappers)
+		ruleNames = append(ruleNames, ruleName)
 	}
+	for ruleName, metadata := range metadataByName {
+		rs.setMetadata(ruleName, metadata)
+	}
+	if err := rs.checkRuleReferences(ruleNames); err != nil {
+		return err
+	}
+
+	rf.rulesMu.Lock()
+	defer rf.rulesMu.Unlock()
+	rf.rules.Store(rs)
 	return nil
 }
 
-// AddRule adds the given expressions with the rule names (key of the map) to the tagger.
-func (rf *Tagger) AddRules(rulesByName map[string][]string) error {
-	for key, exprs := range rulesByName {
-		err := rf.AddRule(key, exprs)
+// RemoveRule removes the rule with the given name and all its expressions from the tagger.
+// The rules that reference the removed rule are kept and the reference is evaluated as false.
+// Returns false if the rule was not found.
+func (rf *Tagger) RemoveRule(ruleName string) (found bool) {
+	_ = rf.updateRules(func(rs *ruleSet) error {
+		found = rs.removeRule(ruleName)
+		return nil
+	})
+	return
+}
+
+// ReplaceRule replaces the expressions of the rule with the given name, adding the rule
+// if it does not exist. The metadata of the rule is kept. If any of the expressions is
+// invalid or its references are invalid (see AddRule) the error is returned and the
+// tagger is not changed.
+func (rf *Tagger) ReplaceRule(ruleName string, expressions []string) error {
+	return rf.updateRules(func(rs *ruleSet) error {
+		exprWrappers, err := parseExpressions(expressions, rf.leftToRight)
 		if err != nil {
 			return err
 		}
-	}
-	return nil
+
+		rs.removeExpressions(ruleName)
+		for _, ew := range exprWrappers {
+			rs.addReferences(ew.Expression)
+		}
+		rs.expressionWrapperByExprName[ruleName] = exprWrappers
+		return rs.checkRuleReferences([]string{ruleName})
+	})
+}
+
+// ClearRules removes all rules from the tagger.
+func (rf *Tagger) ClearRules() {
+	rf.rulesMu.Lock()
+	defer rf.rulesMu.Unlock()
+	rf.rules.Store(newRuleSet())
+}
+
+// SetFieldTagKey sets the struct tag key (eg: "json" or "gotagthem") that will be used
+// to name the struct fields when building the field paths on TagObject and ProcessObject.
+// Fields without the tag keep their names and fields tagged with "-" are skipped.
+// The fields of the embedded structs without a name on the tag are added to the
+// path of the parent, like encoding/json does (eg: "email" instead of "Base.email").
+// Use an empty key to always use the struct field names.
+func (rf *Tagger) SetFieldTagKey(key string) {
+	rf.fieldTagKey = key
+}
+
+// SetWorkers sets the number of goroutines used to run the taggers. When it is set
+// to 2 or more the fields and the taggers of each field are processed concurrently,
+// the order of the returned FieldsInfo is kept the same as the serial processing.
+// Values lower than 2 process everything serially, which is the default.
+func (rf *Tagger) SetWorkers(workers int) {
+	rf.workers = workers
+}
+
+// SetJsonNumbersAsFloat sets if all json numbers (json.Number) must be processed by the FloatTaggers.
+// By default integral numbers are processed by the IntTaggers and the others by the FloatTaggers.
+func (rf *Tagger) SetJsonNumbersAsFloat(asFloat bool) {
+	rf.jsonNumbersAsFloat = asFloat
+}
+
+// SetSplitJsonArrays sets if TagJsonReader and ProcessJsonReader must call fn for each
+// element of the top-level json arrays instead of once for the whole array, so a huge
+// array of documents is not kept on memory until it is fully read. Each element is tagged
+// as a document, so its field paths do not have the index of the element on the array.
+func (rf *Tagger) SetSplitJsonArrays(split bool) {
+	rf.splitJsonArrays = split
+}
+
+// SetFieldPathMatching sets how the plain field paths of the expressions and the include
+// and exclude paths are matched with the field paths where the tags were found.
+// By default dsl.SegmentMatching is used, so "user" does not match "username";
+// use dsl.PrefixMatching to match any field path that starts with the path.
+func (rf *Tagger) SetFieldPathMatching(matching dsl.FieldPathMatching) {
+	rf.fieldPathMatching = matching
+}
+
+// SetLeftToRight sets if the expressions of the rules added after it must be parsed
+// strictly from left to right, ignoring the precedence of the operators, like the
+// older versions of the parser (see dsl.Parser.SetLeftToRight). It is used by AddRule,
+// AddRules, ReplaceRule, ReloadRules and the rule definitions, so it must be set
+// before the rules are added (eg: use NewTagger instead of NewTaggerWithRules).
+func (rf *Tagger) SetLeftToRight(leftToRight bool) {
+	rf.leftToRight = leftToRight
 }
 
 // GetFieldNames returns all the unique fields that can be found on all the expressions.
 func (rf *Tagger) GetFieldNames() (fields []string) {
-	for field := range rf.fields {
+	for field := range rf.loadRules().fields {
 		fields = append(fields, field)
 	}
 	return
 }
 
-// TagJson tags the fields of a data of type json. Warning at the moment golang json unmarshal,
-// when provided a interface{} as the target object, consider all numbers as float64.
-// So use the FloatTagger instead of IntTagger for tagging numbers.
+// TagJson tags the fields of a data of type json. The numbers are decoded as json.Number,
+// integral numbers are processed by the IntTaggers and the others by the FloatTaggers.
+// Use SetJsonNumbersAsFloat to process all numbers with the FloatTaggers.
 func (rf *Tagger) TagJson(
 	data string,
 	includePaths []string,
 	excludePaths []string,
+) (fieldsInfo FieldsInfo, err error) {
+	return rf.TagJsonContext(context.Background(), data, includePaths, excludePaths)
+}
+
+// TagJsonContext is the same as TagJson but the given context is passed to the taggers
+// and the tagging stops when it is done.
+func (rf *Tagger) TagJsonContext(
+	ctx context.Context,
+	data string,
+	includePaths []string,
+	excludePaths []string,
 ) (fieldsInfo FieldsInfo, err error) {
 	var genericObj interface{}
-	err = json.Unmarshal([]byte(data), &genericObj)
+	dec := json.NewDecoder(strings.NewReader(data))
+	dec.UseNumber()
+	err = dec.Decode(&genericObj)
 	if err != nil {
 		return
 	}
-	err = rf.setFieldInfos(genericObj, "", &fieldsInfo, includePaths, excludePaths)
-	return
+	if tok, tokErr := dec.Token(); tokErr != io.EOF {
+		if tokErr != nil {
+			return nil, tokErr
+		}
+		return nil, fmt.Errorf("invalid json: unexpected token %v after top-level value", tok)
+	}
+	return rf.tagValue(ctx, reflect.ValueOf(genericObj), includePaths, excludePaths)
 }
 
 // TagObject tags the fields of a data of type interface.
+// Pointers and interfaces are followed, nil values are skipped and
+// pointers that were already visited on the current path are ignored
+// so self referencing objects can be tagged.
+// The fields are processed by the taggers of their go type, so a float field
+// with an integral value is processed by the FloatTaggers while the same number
+// on TagJson is processed by the IntTaggers.
 func (rf *Tagger) TagObject(
 	data interface{},
 	includePaths []string,
 	excludePaths []string,
 ) (fieldsInfo FieldsInfo, err error) {
-	err = rf.setFieldInfos(data, "", &fieldsInfo, includePaths, excludePaths)
-	return
+	return rf.TagObjectContext(context.Background(), data, includePaths, excludePaths)
+}
+
+// TagObjectContext is the same as TagObject but the given context is passed to the taggers
+// and the tagging stops when it is done.
+func (rf *Tagger) TagObjectContext(
+	ctx context.Context,
+	data interface{},
+	includePaths []string,
+	excludePaths []string,
+) (fieldsInfo FieldsInfo, err error) {
+	return rf.tagValue(ctx, reflect.ValueOf(data), includePaths, excludePaths)
 }
 
 // TagText tags the fields of a string.
 func (rf *Tagger) TagText(
 	data string,
 ) (extractorInfoByTaggerName map[string]TaggerInfo, err error) {
-	fieldsInfo, err := rf.TagObject(data, nil, nil)
-	return fieldsInfo[0].Taggers, err
+	return rf.TagTextContext(context.Background(), data)
+}
+
+// TagTextContext is the same as TagText but the given context is passed to the taggers.
+func (rf *Tagger) TagTextContext(
+	ctx context.Context,
+	data string,
+) (extractorInfoByTaggerName map[string]TaggerInfo, err error) {
+	fieldsInfo, err := rf.TagObjectContext(ctx, data, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return fieldsInfo[0].Taggers, nil
 }
 
 // EvaluateRules evaluate all rules with the given fields by tag.
+// Only the expressions that reference one of the given tags or a rule that is true,
+// or that are true when no tag is found (eg: not "tag1"), are solved.
+// The rules are solved after the rules that they reference (eg: rule("name")), a
+// reference is true if any of the expressions of the referenced rule is true.
 func (rf *Tagger) EvaluateRules(
 	fieldsByTag map[string][]string,
 ) (expressionsByRule map[string][]string, err error) {
 	expressionsByRule = make(map[string][]string)
-	for name, exprWrappers := range rf.expressionWrapperByExprName {
-		for _, ew := range exprWrappers {
-			eval, err := ew.Expression.Solve(fieldsByTag)
-			if err != nil {
-				return nil, err
-			}
-			if eval {
-				expressionsByRule[name] = append(expressionsByRule[name], ew.ExpressionString)
-			}
+	index := rf.loadRules().getIndex()
+	err = index.evaluate(fieldsByTag, func(id int, firedRules map[string]bool) (bool, error) {
+		ie := index.exprs[id]
+		eval, err := ie.ew.Expression.SolveWithOptions(fieldsByTag, dsl.SolveOptions{
+			Matching:   rf.fieldPathMatching,
+			FieldPaths: index.fieldPaths,
+			FiredRules: firedRules,
+		})
+		if err != nil {
+			return false, err
 		}
+		if eval {
+			expressionsByRule[ie.ruleName] = append(expressionsByRule[ie.ruleName], ie.ew.ExpressionString)
+		}
+		return eval, nil
+	})
+	if err != nil {
+		return nil, err
 	}
 	return
 }
@@ -192,7 +476,17 @@ func (rf *Tagger) ProcessJson(
 	includePaths []string,
 	excludePaths []string,
 ) (expressionsByRule map[string][]string, err error) {
-	fieldsInfo, err := rf.TagJson(rawJson, includePaths, excludePaths)
+	return rf.ProcessJsonContext(context.Background(), rawJson, includePaths, excludePaths)
+}
+
+// ProcessJsonContext is the same as ProcessJson but the given context is passed to the taggers.
+func (rf *Tagger) ProcessJsonContext(
+	ctx context.Context,
+	rawJson string,
+	includePaths []string,
+	excludePaths []string,
+) (expressionsByRule map[string][]string, err error) {
+	fieldsInfo, err := rf.TagJsonContext(ctx, rawJson, includePaths, excludePaths)
 	if err != nil {
 		return nil, err
 	}
@@ -209,7 +503,17 @@ func (rf *Tagger) ProcessObject(
 	includePaths []string,
 	excludePaths []string,
 ) (expressionsByRule map[string][]string, err error) {
-	fieldsInfo, err := rf.TagObject(obj, includePaths, excludePaths)
+	return rf.ProcessObjectContext(context.Background(), obj, includePaths, excludePaths)
+}
+
+// ProcessObjectContext is the same as ProcessObject but the given context is passed to the taggers.
+func (rf *Tagger) ProcessObjectContext(
+	ctx context.Context,
+	obj interface{},
+	includePaths []string,
+	excludePaths []string,
+) (expressionsByRule map[string][]string, err error) {
+	fieldsInfo, err := rf.TagObjectContext(ctx, obj, includePaths, excludePaths)
 	if err != nil {
 		return nil, err
 	}
@@ -218,10 +522,20 @@ func (rf *Tagger) ProcessObject(
 }
 
 // ProcessJson extract all tags and evaluate all rules for the given string.
+// The tags are found without field paths, so the field paths of the expressions
+// never match and count("tag") is 1 for each tag found.
 func (rf *Tagger) ProcessText(
 	data string,
 ) (expressionsByRule map[string][]string, err error) {
-	extractorInfoByTaggerName, err := rf.TagText(data)
+	return rf.ProcessTextContext(context.Background(), data)
+}
+
+// ProcessTextContext is the same as ProcessText but the given context is passed to the taggers.
+func (rf *Tagger) ProcessTextContext(
+	ctx context.Context,
+	data string,
+) (expressionsByRule map[string][]string, err error) {
+	extractorInfoByTaggerName, err := rf.TagTextContext(ctx, data)
 	if err != nil {
 		return nil, err
 	}
@@ -1,7 +1,12 @@
 package tagger
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"sync"
 	"testing"
 
 	"github.com/pedroegsilva/gotagthem/dsl"
@@ -21,28 +26,22 @@ func TestNewTagger(t *testing.T) {
 			stringTaggers: []StringTagger{},
 			intTaggers:    []IntTagger{},
 			floatTaggers:  []FloatTagger{},
-			expectedTagger: &Tagger{
-				stringTaggers:               []StringTagger{},
-				intTaggers:                  []IntTagger{},
-				floatTaggers:                []FloatTagger{},
-				expressionWrapperByExprName: make(map[string][]ExpressionWrapper),
-				fields:                      make(map[string]struct{}),
-				tags:                        make(map[string]struct{}),
-			},
+			expectedTagger: taggerWithRules(&Tagger{
+				stringTaggers: []StringContextTagger{},
+				intTaggers:    []IntContextTagger{},
+				floatTaggers:  []FloatContextTagger{},
+			}, newRuleSet()),
 			message: "empty tagger",
 		},
 		{
 			stringTaggers: []StringTagger{&emptyStrTagger{}},
 			intTaggers:    []IntTagger{&emptyIntTagger{}},
 			floatTaggers:  []FloatTagger{&emptyFloatTagger{}},
-			expectedTagger: &Tagger{
-				stringTaggers:               []StringTagger{&emptyStrTagger{}},
-				intTaggers:                  []IntTagger{&emptyIntTagger{}},
-				floatTaggers:                []FloatTagger{&emptyFloatTagger{}},
-				expressionWrapperByExprName: make(map[string][]ExpressionWrapper),
-				fields:                      make(map[string]struct{}),
-				tags:                        make(map[string]struct{}),
-			},
+			expectedTagger: taggerWithRules(&Tagger{
+				stringTaggers: []StringContextTagger{NewStringContextTagger(&emptyStrTagger{})},
+				intTaggers:    []IntContextTagger{NewIntContextTagger(&emptyIntTagger{})},
+				floatTaggers:  []FloatContextTagger{NewFloatContextTagger(&emptyFloatTagger{})},
+			}, newRuleSet()),
 			message: "tagger with empty taggers",
 		},
 	}
@@ -53,13 +52,35 @@ func TestNewTagger(t *testing.T) {
 	}
 }
 
-func TestNewTaggerWithRules(t *testing.T) {
+func TestNewTaggerWithBool(t *testing.T) {
 	assert := assert.New(t)
 	tests := []struct {
-		rulesByName    map[string][]string
+		boolTaggers    []BoolTagger
 		expectedTagger *Tagger
-		expectedErr    error
 		message        string
+	}{
+		{
+			boolTaggers: []BoolTagger{&emptyBoolTagger{}},
+			expectedTagger: taggerWithRules(&Tagger{
+				boolTaggers: []BoolContextTagger{NewBoolContextTagger(&emptyBoolTagger{})},
+			}, newRuleSet()),
+			message: "tagger with bool tagger",
+		},
+	}
+
+	for _, tc := range tests {
+		tagger := NewTaggerWithBool(nil, nil, nil, tc.boolTaggers)
+		assert.Equal(tc.expectedTagger, tagger, tc.message)
+	}
+}
+
+func TestNewTaggerWithRules(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		rulesByName   map[string][]string
+		expectedRules *ruleSet
+		expectedErr   error
+		message       string
 	}{
 		{
 			rulesByName: map[string][]string{
@@ -72,7 +93,7 @@ func TestNewTaggerWithRules(t *testing.T) {
 					`"tag4"`,
 				},
 			},
-			expectedTagger: &Tagger{
+			expectedRules: &ruleSet{
 				expressionWrapperByExprName: map[string][]ExpressionWrapper{
 					"rule1": {
 						{
@@ -107,15 +128,15 @@ func TestNewTaggerWithRules(t *testing.T) {
 						},
 					},
 				},
-				fields: map[string]struct{}{
-					"field1":        {},
-					"field2.field3": {},
+				fields: map[string]int{
+					"field1":        1,
+					"field2.field3": 1,
 				},
-				tags: map[string]struct{}{
-					"tag1": {},
-					"tag2": {},
-					"tag3": {},
-					"tag4": {},
+				tags: map[string]int{
+					"tag1": 1,
+					"tag2": 1,
+					"tag3": 1,
+					"tag4": 1,
 				},
 			},
 			expectedErr: nil,
@@ -125,31 +146,43 @@ func TestNewTaggerWithRules(t *testing.T) {
 			rulesByName: map[string][]string{
 				"rule1": {`"tag1`},
 			},
-			expectedTagger: &Tagger{
+			expectedRules: &ruleSet{
 				expressionWrapperByExprName: map[string][]ExpressionWrapper{},
-				fields:                      map[string]struct{}{},
-				tags:                        map[string]struct{}{},
+				fields:                      map[string]int{},
+				tags:                        map[string]int{},
+			},
+			expectedErr: RuleErrors{
+				&RuleError{
+					RuleName:        "rule1",
+					ExpressionIndex: 0,
+					Expression:      `"tag1`,
+					Err: &dsl.ParseError{
+						Pos:   dsl.Position{Offset: 5, Line: 1, Column: 6},
+						Token: dsl.ILLEGAL,
+						Lit:   "",
+						Msg:   "fail to scan tag: expected ':' but found EOF",
+					},
+				},
 			},
-			expectedErr: fmt.Errorf("fail to scan tag: expected ':' but found EOF"),
-			message:     "new tagger with invalid rules",
+			message: "new tagger with invalid rules",
 		},
 	}
 
 	for _, tc := range tests {
 		tagger, err := NewTaggerWithRules(nil, nil, nil, tc.rulesByName)
 		assert.Equal(tc.expectedErr, err, tc.message)
-		assert.Equal(tc.expectedTagger, tagger, tc.message)
+		assert.Equal(tc.expectedRules, tagger.loadRules(), tc.message)
 	}
 }
 
 func TestAddRule(t *testing.T) {
 	assert := assert.New(t)
 	tests := []struct {
-		ruleName       string
-		expressions    []string
-		expectedTagger *Tagger
-		expectedErr    error
-		message        string
+		ruleName      string
+		expressions   []string
+		expectedRules *ruleSet
+		expectedErr   error
+		message       string
 	}{
 		{
 			ruleName: "rule1",
@@ -157,7 +190,7 @@ func TestAddRule(t *testing.T) {
 				`"tag1"`,
 				`"tag2:field1"`,
 			},
-			expectedTagger: &Tagger{
+			expectedRules: &ruleSet{
 				expressionWrapperByExprName: map[string][]ExpressionWrapper{
 					"rule1": {
 						{
@@ -176,12 +209,12 @@ func TestAddRule(t *testing.T) {
 						},
 					},
 				},
-				fields: map[string]struct{}{
-					"field1": {},
+				fields: map[string]int{
+					"field1": 1,
 				},
-				tags: map[string]struct{}{
-					"tag1": {},
-					"tag2": {},
+				tags: map[string]int{
+					"tag1": 1,
+					"tag2": 1,
 				},
 			},
 			expectedErr: nil,
@@ -192,13 +225,18 @@ func TestAddRule(t *testing.T) {
 			expressions: []string{
 				`"tag1`,
 			},
-			expectedTagger: &Tagger{
+			expectedRules: &ruleSet{
 				expressionWrapperByExprName: map[string][]ExpressionWrapper{},
-				fields:                      map[string]struct{}{},
-				tags:                        map[string]struct{}{},
+				fields:                      map[string]int{},
+				tags:                        map[string]int{},
 			},
-			expectedErr: fmt.Errorf("fail to scan tag: expected ':' but found EOF"),
-			message:     "add invalid expression",
+			expectedErr: &dsl.ParseError{
+				Pos:   dsl.Position{Offset: 5, Line: 1, Column: 6},
+				Token: dsl.ILLEGAL,
+				Lit:   "",
+				Msg:   "fail to scan tag: expected ':' but found EOF",
+			},
+			message: "add invalid expression",
 		},
 	}
 
@@ -206,17 +244,17 @@ func TestAddRule(t *testing.T) {
 		tagger := NewTagger(nil, nil, nil)
 		err := tagger.AddRule(tc.ruleName, tc.expressions)
 		assert.Equal(tc.expectedErr, err, tc.message)
-		assert.Equal(tc.expectedTagger, tagger, tc.message)
+		assert.Equal(tc.expectedRules, tagger.loadRules(), tc.message)
 	}
 }
 
 func TestAddRules(t *testing.T) {
 	assert := assert.New(t)
 	tests := []struct {
-		rulesByName    map[string][]string
-		expectedTagger *Tagger
-		expectedErr    error
-		message        string
+		rulesByName   map[string][]string
+		expectedRules *ruleSet
+		expectedErr   error
+		message       string
 	}{
 		{
 			rulesByName: map[string][]string{
@@ -229,7 +267,7 @@ func TestAddRules(t *testing.T) {
 					`"tag4"`,
 				},
 			},
-			expectedTagger: &Tagger{
+			expectedRules: &ruleSet{
 				expressionWrapperByExprName: map[string][]ExpressionWrapper{
 					"rule1": {
 						{
@@ -264,15 +302,15 @@ func TestAddRules(t *testing.T) {
 						},
 					},
 				},
-				fields: map[string]struct{}{
-					"field1":        {},
-					"field2.field3": {},
+				fields: map[string]int{
+					"field1":        1,
+					"field2.field3": 1,
 				},
-				tags: map[string]struct{}{
-					"tag1": {},
-					"tag2": {},
-					"tag3": {},
-					"tag4": {},
+				tags: map[string]int{
+					"tag1": 1,
+					"tag2": 1,
+					"tag3": 1,
+					"tag4": 1,
 				},
 			},
 			message: "add rules with valid rules",
@@ -281,13 +319,75 @@ func TestAddRules(t *testing.T) {
 			rulesByName: map[string][]string{
 				"rule1": {`"tag1`},
 			},
-			expectedTagger: &Tagger{
+			expectedRules: &ruleSet{
+				expressionWrapperByExprName: map[string][]ExpressionWrapper{},
+				fields:                      map[string]int{},
+				tags:                        map[string]int{},
+			},
+			expectedErr: RuleErrors{
+				&RuleError{
+					RuleName:        "rule1",
+					ExpressionIndex: 0,
+					Expression:      `"tag1`,
+					Err: &dsl.ParseError{
+						Pos:   dsl.Position{Offset: 5, Line: 1, Column: 6},
+						Token: dsl.ILLEGAL,
+						Lit:   "",
+						Msg:   "fail to scan tag: expected ':' but found EOF",
+					},
+				},
+			},
+			message: "add rules with invalid rule",
+		},
+		{
+			rulesByName: map[string][]string{
+				"rule1": {`"tag1"`, `"tag2" and`, `"tag3`},
+				"rule2": {`"tag4"`},
+				"rule0": {`("tag5"`},
+			},
+			expectedRules: &ruleSet{
 				expressionWrapperByExprName: map[string][]ExpressionWrapper{},
-				fields:                      map[string]struct{}{},
-				tags:                        map[string]struct{}{},
+				fields:                      map[string]int{},
+				tags:                        map[string]int{},
 			},
-			expectedErr: fmt.Errorf("fail to scan tag: expected ':' but found EOF"),
-			message:     "add rules with invalid rule",
+			expectedErr: RuleErrors{
+				&RuleError{
+					RuleName:        "rule0",
+					ExpressionIndex: 0,
+					Expression:      `("tag5"`,
+					Err: &dsl.ParseError{
+						Pos:      dsl.Position{Offset: 7, Line: 1, Column: 8},
+						Token:    dsl.EOF,
+						Lit:      "",
+						Expected: []dsl.Token{dsl.AND, dsl.OR, dsl.CLPAR},
+						Msg:      "invalid expression: Unexpected '('",
+					},
+				},
+				&RuleError{
+					RuleName:        "rule1",
+					ExpressionIndex: 1,
+					Expression:      `"tag2" and`,
+					Err: &dsl.ParseError{
+						Pos:      dsl.Position{Offset: 10, Line: 1, Column: 11},
+						Token:    dsl.EOF,
+						Lit:      "",
+						Expected: []dsl.Token{dsl.TAG, dsl.TRUE, dsl.FALSE, dsl.ATLEAST, dsl.ANYOF, dsl.COUNT, dsl.SAMEFIELD, dsl.SAMEPARENT, dsl.RULE, dsl.OPPAR, dsl.NOT},
+						Msg:      "invalid expression: incomplete expression AND",
+					},
+				},
+				&RuleError{
+					RuleName:        "rule1",
+					ExpressionIndex: 2,
+					Expression:      `"tag3`,
+					Err: &dsl.ParseError{
+						Pos:   dsl.Position{Offset: 5, Line: 1, Column: 6},
+						Token: dsl.ILLEGAL,
+						Lit:   "",
+						Msg:   "fail to scan tag: expected ':' but found EOF",
+					},
+				},
+			},
+			message: "add rules with multiple invalid rules",
 		},
 	}
 
@@ -295,8 +395,323 @@ func TestAddRules(t *testing.T) {
 		tagger := NewTagger(nil, nil, nil)
 		err := tagger.AddRules(tc.rulesByName)
 		assert.Equal(tc.expectedErr, err, tc.message)
-		assert.Equal(tc.expectedTagger, tagger, tc.message)
+		assert.Equal(tc.expectedRules, tagger.loadRules(), tc.message)
+	}
+}
+
+func TestRuleErrors(t *testing.T) {
+	assert := assert.New(t)
+	ruleErrs := RuleErrors{
+		&RuleError{
+			RuleName:        "rule1",
+			ExpressionIndex: 0,
+			Expression:      `"tag1`,
+			Err:             fmt.Errorf("fail to scan tag: expected ':' but found EOF"),
+		},
+		&RuleError{
+			RuleName:        "rule2",
+			ExpressionIndex: 3,
+			Expression:      `"tag2" and`,
+			Err: &dsl.ParseError{
+				Pos:      dsl.Position{Offset: 10, Line: 1, Column: 11},
+				Token:    dsl.EOF,
+				Lit:      "",
+				Expected: []dsl.Token{dsl.TAG, dsl.TRUE, dsl.FALSE, dsl.ATLEAST, dsl.ANYOF, dsl.COUNT, dsl.SAMEFIELD, dsl.SAMEPARENT, dsl.RULE, dsl.OPPAR, dsl.NOT},
+				Msg:      "invalid expression: incomplete expression AND",
+			},
+		},
+	}
+	assert.Equal(
+		`2 invalid expressions found: rule "rule1" expression 0: fail to scan tag: expected ':' but found EOF; `+
+			`rule "rule2" expression 3: invalid expression: incomplete expression AND (line 1, column 11)`,
+		ruleErrs.Error(),
+		"rule errors message",
+	)
+	assert.Equal(ruleErrs[0].Err, errors.Unwrap(ruleErrs[0]), "rule error unwrap")
+}
+
+func TestRemoveRule(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		ruleName       string
+		expectedFound  bool
+		expectedRules  []string
+		expectedTags   map[string]int
+		expectedFields map[string]int
+		message        string
+	}{
+		{
+			ruleName:      "rule1",
+			expectedFound: true,
+			expectedRules: []string{"rule2"},
+			expectedTags: map[string]int{
+				"tag2": 1,
+				"tag3": 1,
+			},
+			expectedFields: map[string]int{
+				"field1": 1,
+			},
+			message: "remove rule with shared tags",
+		},
+		{
+			ruleName:      "rule2",
+			expectedFound: true,
+			expectedRules: []string{"rule1"},
+			expectedTags: map[string]int{
+				"tag1": 1,
+				"tag2": 2,
+			},
+			expectedFields: map[string]int{
+				"field1": 1,
+			},
+			message: "remove rule with shared fields",
+		},
+		{
+			ruleName:      "rule3",
+			expectedFound: false,
+			expectedRules: []string{"rule1", "rule2"},
+			expectedTags: map[string]int{
+				"tag1": 1,
+				"tag2": 3,
+				"tag3": 1,
+			},
+			expectedFields: map[string]int{
+				"field1": 2,
+			},
+			message: "remove missing rule",
+		},
+	}
+
+	for _, tc := range tests {
+		tagger, err := NewTaggerWithRules(nil, nil, nil, map[string][]string{
+			"rule1": {`"tag1" and "tag2:field1"`, `"tag2"`},
+			"rule2": {`"tag2:field1" or "tag3:field1" or "tag2"`},
+		})
+		assert.Nil(err, tc.message+" new tagger")
+		found := tagger.RemoveRule(tc.ruleName)
+		assert.Equal(tc.expectedFound, found, tc.message+" found")
+		var rules []string
+		for rule := range tagger.loadRules().expressionWrapperByExprName {
+			rules = append(rules, rule)
+		}
+		assert.ElementsMatch(tc.expectedRules, rules, tc.message+" rules")
+		assert.Equal(tc.expectedTags, tagger.loadRules().tags, tc.message+" tags")
+		assert.Equal(tc.expectedFields, tagger.loadRules().fields, tc.message+" fields")
+	}
+}
+
+func TestReplaceRule(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		ruleName       string
+		expressions    []string
+		expectedErr    error
+		expectedRules  map[string][]string
+		expectedTags   map[string]int
+		expectedFields map[string]int
+		message        string
+	}{
+		{
+			ruleName:    "rule1",
+			expressions: []string{`"tag3:field2"`},
+			expectedRules: map[string][]string{
+				"rule1": {`"tag3:field2"`},
+				"rule2": {`"tag2:field1"`},
+			},
+			expectedTags: map[string]int{
+				"tag2": 1,
+				"tag3": 1,
+			},
+			expectedFields: map[string]int{
+				"field1": 1,
+				"field2": 1,
+			},
+			message: "replace existing rule",
+		},
+		{
+			ruleName:    "rule3",
+			expressions: []string{`"tag1"`},
+			expectedRules: map[string][]string{
+				"rule1": {`"tag1" and "tag2:field1"`},
+				"rule2": {`"tag2:field1"`},
+				"rule3": {`"tag1"`},
+			},
+			expectedTags: map[string]int{
+				"tag1": 2,
+				"tag2": 2,
+			},
+			expectedFields: map[string]int{
+				"field1": 2,
+			},
+			message: "replace missing rule",
+		},
+		{
+			ruleName:    "rule1",
+			expressions: []string{`"tag3"`, `"tag4`},
+			expectedErr: &dsl.ParseError{
+				Pos:   dsl.Position{Offset: 5, Line: 1, Column: 6},
+				Token: dsl.ILLEGAL,
+				Lit:   "",
+				Msg:   "fail to scan tag: expected ':' but found EOF",
+			},
+			expectedRules: map[string][]string{
+				"rule1": {`"tag1" and "tag2:field1"`},
+				"rule2": {`"tag2:field1"`},
+			},
+			expectedTags: map[string]int{
+				"tag1": 1,
+				"tag2": 2,
+			},
+			expectedFields: map[string]int{
+				"field1": 2,
+			},
+			message: "replace with invalid expression",
+		},
+	}
+
+	rule1Metadata := RuleMetadata{Severity: "high", Owner: "some team"}
+	for _, tc := range tests {
+		tagger := NewTagger(nil, nil, nil)
+		err := tagger.AddRuleDefinitions([]RuleDefinition{
+			{Name: "rule1", Expressions: []string{`"tag1" and "tag2:field1"`}, Severity: "high", Owner: "some team"},
+			{Name: "rule2", Expressions: []string{`"tag2:field1"`}},
+		})
+		assert.Nil(err, tc.message+" new tagger")
+		err = tagger.ReplaceRule(tc.ruleName, tc.expressions)
+		assert.Equal(tc.expectedErr, err, tc.message+" expected error")
+		rules := make(map[string][]string)
+		for rule, exprWrappers := range tagger.loadRules().expressionWrapperByExprName {
+			for _, ew := range exprWrappers {
+				rules[rule] = append(rules[rule], ew.ExpressionString)
+			}
+		}
+		assert.Equal(tc.expectedRules, rules, tc.message+" rules")
+		assert.Equal(tc.expectedTags, tagger.loadRules().tags, tc.message+" tags")
+		assert.Equal(tc.expectedFields, tagger.loadRules().fields, tc.message+" fields")
+		metadata, ok := tagger.GetRuleMetadata("rule1")
+		assert.True(ok, tc.message+" metadata is kept")
+		assert.Equal(rule1Metadata, metadata, tc.message+" metadata is kept")
+	}
+}
+
+func TestClearRules(t *testing.T) {
+	assert := assert.New(t)
+	tagger, err := NewTaggerWithRules(nil, nil, nil, map[string][]string{
+		"rule1": {`"tag1" and "tag2:field1"`},
+	})
+	assert.Nil(err, "new tagger")
+	tagger.ClearRules()
+	assert.Equal(NewTagger(nil, nil, nil), tagger, "cleared tagger")
+	assert.Nil(tagger.GetFieldNames(), "cleared field names")
+}
+
+func TestReloadRules(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		rulesByName   map[string][]string
+		expectedErr   error
+		expectedRules *ruleSet
+		message       string
+	}{
+		{
+			rulesByName: map[string][]string{
+				"rule2": {`"tag2:field1"`},
+			},
+			expectedRules: &ruleSet{
+				expressionWrapperByExprName: map[string][]ExpressionWrapper{
+					"rule2": {
+						{
+							ExpressionString: `"tag2:field1"`,
+							Expression: &dsl.Expression{
+								Type: dsl.UNIT_EXPR,
+								Tag:  dsl.TagInfo{Name: "tag2", FieldPath: "field1"},
+							},
+						},
+					},
+				},
+				fields: map[string]int{"field1": 1},
+				tags:   map[string]int{"tag2": 1},
+			},
+			message: "reload valid rules",
+		},
+		{
+			rulesByName: map[string][]string{
+				"rule2": {`"tag2:field1"`},
+				"rule3": {`"tag3`},
+			},
+			expectedErr: RuleErrors{
+				&RuleError{
+					RuleName:        "rule3",
+					ExpressionIndex: 0,
+					Expression:      `"tag3`,
+					Err: &dsl.ParseError{
+						Pos:   dsl.Position{Offset: 5, Line: 1, Column: 6},
+						Token: dsl.ILLEGAL,
+						Lit:   "",
+						Msg:   "fail to scan tag: expected ':' but found EOF",
+					},
+				},
+			},
+			expectedRules: &ruleSet{
+				expressionWrapperByExprName: map[string][]ExpressionWrapper{
+					"rule1": {
+						{
+							ExpressionString: `"tag1"`,
+							Expression: &dsl.Expression{
+								Type: dsl.UNIT_EXPR,
+								Tag:  dsl.TagInfo{Name: "tag1"},
+							},
+						},
+					},
+				},
+				fields: map[string]int{},
+				tags:   map[string]int{"tag1": 1},
+			},
+			message: "reload invalid rules keeps the old rules",
+		},
+	}
+
+	for _, tc := range tests {
+		tagger, err := NewTaggerWithRules(nil, nil, nil, map[string][]string{"rule1": {`"tag1"`}})
+		assert.Nil(err, tc.message+" new tagger")
+		err = tagger.ReloadRules(tc.rulesByName)
+		assert.Equal(tc.expectedErr, err, tc.message+" expected error")
+		assert.Equal(tc.expectedRules, tagger.loadRules(), tc.message+" rules")
+	}
+}
+
+func TestConcurrentRuleUpdates(t *testing.T) {
+	assert := assert.New(t)
+	tagger, err := NewTaggerWithRules(
+		[]StringTagger{&emptyStrTagger{}},
+		nil,
+		nil,
+		map[string][]string{"rule1": {`"strTag"`}},
+	)
+	assert.Nil(err, "new tagger")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				res, err := tagger.ProcessObject([]string{"some random string"}, nil, nil)
+				assert.Nil(err, "process object")
+				assert.Equal([]string{`"strTag"`}, res["rule1"], "rule1 always matches")
+				tagger.GetFieldNames()
+			}
+		}()
+	}
+
+	for i := 0; i < 100; i++ {
+		name := fmt.Sprintf("rule%d", i+2)
+		assert.Nil(tagger.AddRule(name, []string{`"strTag:field"`}), "add rule")
+		assert.Nil(tagger.ReplaceRule(name, []string{`"otherTag"`}), "replace rule")
+		tagger.RemoveRule(name)
+		assert.Nil(tagger.ReloadRules(map[string][]string{"rule1": {`"strTag"`}, name: {`"strTag"`}}), "reload rules")
 	}
+	wg.Wait()
 }
 
 func TestTagJson(t *testing.T) {
@@ -308,7 +723,7 @@ func TestTagJson(t *testing.T) {
 		message            string
 	}{
 		{
-			rawJsonStr: `{"strField": "some string", "intField": 42, "floatField": 42.42}`,
+			rawJsonStr: `{"strField": "some string", "intField": 42, "floatField": 42.42, "boolField": true}`,
 			expectedFieldsInfo: FieldsInfo{
 				&FieldInfo{
 					Name: "strField",
@@ -319,13 +734,11 @@ func TestTagJson(t *testing.T) {
 						},
 					},
 				},
-				// At the moment golang json unmarshal, when provided a interface{} as the target object
-				// consider all numbers as float 64.
 				&FieldInfo{
 					Name: "intField",
 					Taggers: map[string]TaggerInfo{
-						"emptyFloatTagger": {
-							Tags:    []string{"floatTag"},
+						"emptyIntTagger": {
+							Tags:    []string{"intTag"},
 							RunData: nil,
 						},
 					},
@@ -339,6 +752,15 @@ func TestTagJson(t *testing.T) {
 						},
 					},
 				},
+				&FieldInfo{
+					Name: "boolField",
+					Taggers: map[string]TaggerInfo{
+						"emptyBoolTagger": {
+							Tags:    []string{"boolTag"},
+							RunData: nil,
+						},
+					},
+				},
 			},
 			expectedErr: nil,
 			message:     "tag json",
@@ -346,10 +768,11 @@ func TestTagJson(t *testing.T) {
 	}
 
 	for _, tc := range tests {
-		tagger := NewTagger(
+		tagger := NewTaggerWithBool(
 			[]StringTagger{&emptyStrTagger{}},
 			[]IntTagger{&emptyIntTagger{}},
 			[]FloatTagger{&emptyFloatTagger{}},
+			[]BoolTagger{&emptyBoolTagger{}},
 		)
 		fieldsInfo, err := tagger.TagJson(tc.rawJsonStr, nil, nil)
 		assert.Equal(tc.expectedErr, err, tc.message+" expected error")
@@ -370,6 +793,121 @@ func TestTagJson(t *testing.T) {
 
 }
 
+func TestTagJsonNumbers(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		rawJsonStr      string
+		numbersAsFloat  bool
+		expectedTaggers map[string]string
+		expectedErr     error
+		message         string
+	}{
+		{
+			rawJsonStr: `{"int": 42, "negative": -42, "exp": 1e3, "integralFloat": 42.0, "float": 42.42, "big": 1e300}`,
+			expectedTaggers: map[string]string{
+				"int":           "emptyIntTagger",
+				"negative":      "emptyIntTagger",
+				"exp":           "emptyIntTagger",
+				"integralFloat": "emptyIntTagger",
+				"float":         "emptyFloatTagger",
+				"big":           "emptyFloatTagger",
+			},
+			message: "integral numbers as int",
+		},
+		{
+			rawJsonStr:     `{"int": 42, "float": 42.42}`,
+			numbersAsFloat: true,
+			expectedTaggers: map[string]string{
+				"int":   "emptyFloatTagger",
+				"float": "emptyFloatTagger",
+			},
+			message: "numbers as float",
+		},
+		{
+			rawJsonStr:  `{"int": 42} {"int": 42}`,
+			expectedErr: fmt.Errorf("invalid json: unexpected token { after top-level value"),
+			message:     "extra data after json",
+		},
+	}
+
+	for _, tc := range tests {
+		tagger := NewTagger(nil, []IntTagger{&emptyIntTagger{}}, []FloatTagger{&emptyFloatTagger{}})
+		tagger.SetJsonNumbersAsFloat(tc.numbersAsFloat)
+		fieldsInfo, err := tagger.TagJson(tc.rawJsonStr, nil, nil)
+		assert.Equal(tc.expectedErr, err, tc.message+" expected error")
+		if err != nil {
+			continue
+		}
+		taggers := make(map[string]string)
+		for _, info := range fieldsInfo {
+			for name := range info.Taggers {
+				taggers[info.Name] = name
+			}
+		}
+		assert.Equal(tc.expectedTaggers, taggers, tc.message+" result")
+	}
+}
+
+func TestTagJsonAndObjectConsistency(t *testing.T) {
+	assert := assert.New(t)
+	object := struct {
+		User struct {
+			Age    int     `json:"age"`
+			Height float64 `json:"height"`
+			Admin  bool    `json:"admin"`
+		} `json:"user"`
+	}{}
+	object.User.Age = 42
+	object.User.Height = 1.8
+	object.User.Admin = true
+
+	rawJson, err := json.Marshal(object)
+	assert.Nil(err, "marshal expected error")
+
+	tagger := NewTaggerWithBool(
+		nil,
+		[]IntTagger{&emptyIntTagger{}},
+		[]FloatTagger{&emptyFloatTagger{}},
+		[]BoolTagger{&emptyBoolTagger{}},
+	)
+	tagger.SetFieldTagKey("json")
+	objFieldsInfo, err := tagger.TagObject(object, nil, nil)
+	assert.Nil(err, "tag object expected error")
+	jsonFieldsInfo, err := tagger.TagJson(string(rawJson), nil, nil)
+	assert.Nil(err, "tag json expected error")
+	assert.Equal(objFieldsInfo.GetFieldsByTag(), jsonFieldsInfo.GetFieldsByTag(), "same tags by field")
+}
+
+func TestTagObjectIntegralFloat(t *testing.T) {
+	assert := assert.New(t)
+	object := struct {
+		Weight float64
+	}{Weight: 2.0}
+
+	tagger := NewTagger(
+		nil,
+		[]IntTagger{&emptyIntTagger{}},
+		[]FloatTagger{&emptyFloatTagger{}},
+	)
+	fieldsInfo, err := tagger.TagObject(object, nil, nil)
+	assert.Nil(err, "tag object expected error")
+	assert.Equal(map[string][]string{"floatTag": {"Weight"}}, fieldsInfo.GetFieldsByTag(), "float field with integral value")
+
+	fieldsInfo, err = tagger.TagJson(`{"Weight": 2.0}`, nil, nil)
+	assert.Nil(err, "tag json expected error")
+	assert.Equal(map[string][]string{"intTag": {"Weight"}}, fieldsInfo.GetFieldsByTag(), "integral json number")
+}
+
+// sortedFieldsByTag returns the fields by tag with the fields sorted, since the
+// order of the fields of the json objects is not kept.
+func sortedFieldsByTag(fieldsInfo FieldsInfo) map[string][]string {
+	fieldsByTag := fieldsInfo.GetFieldsByTag()
+	for _, fields := range fieldsByTag {
+		sort.Strings(fields)
+	}
+	return fieldsByTag
+}
+
 func TestTagObject(t *testing.T) {
 	assert := assert.New(t)
 	tests := []struct {
@@ -506,49 +1044,494 @@ func TestTagObject(t *testing.T) {
 			expectedErr: nil,
 			message:     "tag object struct with internal fields",
 		},
-	}
-
-	for _, tc := range tests {
-		tagger := NewTagger(
-			[]StringTagger{&emptyStrTagger{}},
-			[]IntTagger{&emptyIntTagger{}},
-			[]FloatTagger{&emptyFloatTagger{}},
-		)
-		fieldsInfo, err := tagger.TagObject(tc.object, nil, nil)
-		assert.Equal(tc.expectedErr, err, tc.message+" expected error")
-		assert.Equal(len(tc.expectedFieldsInfo), len(fieldsInfo), tc.message+" result length")
-		eqCount := 0
-		for _, info := range fieldsInfo {
-			for _, expInfo := range tc.expectedFieldsInfo {
-				if expInfo.Name == info.Name {
-					res := assert.Equal(expInfo, info, tc.message+" expected field element")
-					if res {
-						eqCount++
-					}
-				}
-			}
-		}
-		assert.Equal(len(tc.expectedFieldsInfo), eqCount, tc.message+" expected equal elements found")
-	}
-
-}
-
-func TestTagText(t *testing.T) {
-	assert := assert.New(t)
-	tests := []struct {
-		text                              string
-		expecterExtractorInfoByTaggerName map[string]TaggerInfo
-		expectedErr                       error
-		message                           string
-	}{
 		{
-			text: `some random string`,
-			expecterExtractorInfoByTaggerName: map[string]TaggerInfo{
-				"emptyStrTagger": {
-					Tags:    []string{"strTag"},
-					RunData: nil,
-				},
-			},
+			object: struct {
+				IsAdmin bool
+				Name    string
+			}{
+				IsAdmin: true,
+				Name:    "some random string",
+			},
+			expectedFieldsInfo: FieldsInfo{
+				&FieldInfo{
+					Name: "IsAdmin",
+					Taggers: map[string]TaggerInfo{
+						"emptyBoolTagger": {
+							Tags:    []string{"boolTag"},
+							RunData: nil,
+						},
+					},
+				},
+				&FieldInfo{
+					Name: "Name",
+					Taggers: map[string]TaggerInfo{
+						"emptyStrTagger": {
+							Tags:    []string{"strTag"},
+							RunData: nil,
+						},
+					},
+				},
+			},
+			expectedErr: nil,
+			message:     "tag object struct with bool field",
+		},
+		{
+			object: func() interface{} {
+				str := "some random string"
+				return struct {
+					StrPtr   *string
+					NilPtr   *string
+					Iface    interface{}
+					NilIface interface{}
+					ObjPtr   *struct{ Field1 int }
+				}{
+					StrPtr: &str,
+					Iface:  42.42,
+					ObjPtr: &struct{ Field1 int }{Field1: 42},
+				}
+			}(),
+			expectedFieldsInfo: FieldsInfo{
+				&FieldInfo{
+					Name: "StrPtr",
+					Taggers: map[string]TaggerInfo{
+						"emptyStrTagger": {
+							Tags:    []string{"strTag"},
+							RunData: nil,
+						},
+					},
+				},
+				&FieldInfo{
+					Name: "Iface",
+					Taggers: map[string]TaggerInfo{
+						"emptyFloatTagger": {
+							Tags:    []string{"floatTag"},
+							RunData: nil,
+						},
+					},
+				},
+				&FieldInfo{
+					Name: "ObjPtr.Field1",
+					Taggers: map[string]TaggerInfo{
+						"emptyIntTagger": {
+							Tags:    []string{"intTag"},
+							RunData: nil,
+						},
+					},
+				},
+			},
+			expectedErr: nil,
+			message:     "tag object struct with pointers and interfaces",
+		},
+		{
+			object: func() interface{} {
+				node := &selfRefNode{Name: "some random string"}
+				node.Next = node
+				return node
+			}(),
+			expectedFieldsInfo: FieldsInfo{
+				&FieldInfo{
+					Name: "Name",
+					Taggers: map[string]TaggerInfo{
+						"emptyStrTagger": {
+							Tags:    []string{"strTag"},
+							RunData: nil,
+						},
+					},
+				},
+			},
+			expectedErr: nil,
+			message:     "tag object self referencing pointer",
+		},
+		{
+			object: func() interface{} {
+				shared := &selfRefNode{Name: "some random string"}
+				return &selfRefNode{Next: shared, Other: shared}
+			}(),
+			expectedFieldsInfo: FieldsInfo{
+				&FieldInfo{
+					Name: "Name",
+					Taggers: map[string]TaggerInfo{
+						"emptyStrTagger": {
+							Tags:    []string{"strTag"},
+							RunData: nil,
+						},
+					},
+				},
+				&FieldInfo{
+					Name: "Next.Name",
+					Taggers: map[string]TaggerInfo{
+						"emptyStrTagger": {
+							Tags:    []string{"strTag"},
+							RunData: nil,
+						},
+					},
+				},
+				&FieldInfo{
+					Name: "Other.Name",
+					Taggers: map[string]TaggerInfo{
+						"emptyStrTagger": {
+							Tags:    []string{"strTag"},
+							RunData: nil,
+						},
+					},
+				},
+			},
+			expectedErr: nil,
+			message:     "tag object shared pointer",
+		},
+		{
+			object: func() interface{} {
+				outer := &aliasOuter{In: aliasInner{Name: "some random string"}}
+				outer.Ptr = &outer.In
+				return outer
+			}(),
+			expectedFieldsInfo: FieldsInfo{
+				&FieldInfo{
+					Name: "In.Name",
+					Taggers: map[string]TaggerInfo{
+						"emptyStrTagger": {
+							Tags:    []string{"strTag"},
+							RunData: nil,
+						},
+					},
+				},
+				&FieldInfo{
+					Name: "Ptr.Name",
+					Taggers: map[string]TaggerInfo{
+						"emptyStrTagger": {
+							Tags:    []string{"strTag"},
+							RunData: nil,
+						},
+					},
+				},
+			},
+			expectedErr: nil,
+			message:     "tag object pointer to the first field",
+		},
+		{
+			object: func() interface{} {
+				s := []interface{}{"some random string", nil}
+				s[1] = s
+				return s
+			}(),
+			expectedFieldsInfo: FieldsInfo{
+				&FieldInfo{
+					Name: "index(0)",
+					Taggers: map[string]TaggerInfo{
+						"emptyStrTagger": {
+							Tags:    []string{"strTag"},
+							RunData: nil,
+						},
+					},
+				},
+			},
+			expectedErr: nil,
+			message:     "tag object self referencing slice",
+		},
+	}
+
+	for _, tc := range tests {
+		tagger := NewTaggerWithBool(
+			[]StringTagger{&emptyStrTagger{}},
+			[]IntTagger{&emptyIntTagger{}},
+			[]FloatTagger{&emptyFloatTagger{}},
+			[]BoolTagger{&emptyBoolTagger{}},
+		)
+		fieldsInfo, err := tagger.TagObject(tc.object, nil, nil)
+		assert.Equal(tc.expectedErr, err, tc.message+" expected error")
+		assert.Equal(len(tc.expectedFieldsInfo), len(fieldsInfo), tc.message+" result length")
+		eqCount := 0
+		for _, info := range fieldsInfo {
+			for _, expInfo := range tc.expectedFieldsInfo {
+				if expInfo.Name == info.Name {
+					res := assert.Equal(expInfo, info, tc.message+" expected field element")
+					if res {
+						eqCount++
+					}
+				}
+			}
+		}
+		assert.Equal(len(tc.expectedFieldsInfo), eqCount, tc.message+" expected equal elements found")
+	}
+
+}
+
+func TestTagObjectWithFieldTagKey(t *testing.T) {
+	assert := assert.New(t)
+	type user struct {
+		Email    string `json:"email" gotagthem:"mail"`
+		Name     string `json:",omitempty"`
+		Password string `json:"-" gotagthem:"-"`
+		Dash     string `json:"-," gotagthem:"-,"`
+		NoTag    string
+	}
+	object := struct {
+		User user `json:"user"`
+	}{
+		User: user{
+			Email:    "some random string",
+			Name:     "some random string",
+			Password: "some random string",
+			Dash:     "some random string",
+			NoTag:    "some random string",
+		},
+	}
+	tests := []struct {
+		fieldTagKey   string
+		expectedNames []string
+		message       string
+	}{
+		{
+			fieldTagKey:   "",
+			expectedNames: []string{"User.Email", "User.Name", "User.Password", "User.Dash", "User.NoTag"},
+			message:       "no field tag key",
+		},
+		{
+			fieldTagKey:   "json",
+			expectedNames: []string{"user.email", "user.Name", "user.-", "user.NoTag"},
+			message:       "json field tag key",
+		},
+		{
+			fieldTagKey:   "gotagthem",
+			expectedNames: []string{"User.mail", "User.Name", "User.-", "User.NoTag"},
+			message:       "custom field tag key",
+		},
+	}
+
+	for _, tc := range tests {
+		tagger := NewTagger([]StringTagger{&emptyStrTagger{}}, nil, nil)
+		tagger.SetFieldTagKey(tc.fieldTagKey)
+		fieldsInfo, err := tagger.TagObject(object, nil, nil)
+		assert.Nil(err, tc.message+" expected error")
+		var names []string
+		for _, info := range fieldsInfo {
+			names = append(names, info.Name)
+		}
+		assert.Equal(tc.expectedNames, names, tc.message+" result")
+	}
+}
+
+func TestTagObjectEmbeddedStructs(t *testing.T) {
+	assert := assert.New(t)
+	object := struct {
+		embeddedBase
+		*EmbeddedAudit
+		Owner embeddedBase `json:"owner"`
+		Named embeddedName `json:"named"`
+		Name  string       `json:"name"`
+	}{
+		embeddedBase:  embeddedBase{Email: "some random string"},
+		EmbeddedAudit: &EmbeddedAudit{CreatedBy: "some random string"},
+		Owner:         embeddedBase{Email: "some random string"},
+		Named:         embeddedName{embeddedBase: embeddedBase{Email: "some random string"}},
+		Name:          "some random string",
+	}
+	rawJson, err := json.Marshal(object)
+	assert.Nil(err, "marshal expected error")
+
+	tests := []struct {
+		fieldTagKey         string
+		expectedFieldsByTag map[string][]string
+		message             string
+	}{
+		{
+			fieldTagKey: "json",
+			expectedFieldsByTag: map[string][]string{
+				"strTag": {"createdBy", "email", "name", "named.base.email", "owner.email"},
+			},
+			message: "promoted fields",
+		},
+		{
+			fieldTagKey: "",
+			expectedFieldsByTag: map[string][]string{
+				"strTag": {"EmbeddedAudit.CreatedBy", "Name", "Owner.Email"},
+			},
+			message: "no field tag key",
+		},
+	}
+
+	for _, tc := range tests {
+		tagger := NewTagger([]StringTagger{&emptyStrTagger{}}, nil, nil)
+		tagger.SetFieldTagKey(tc.fieldTagKey)
+		fieldsInfo, err := tagger.TagObject(object, nil, nil)
+		assert.Nil(err, tc.message+" expected error")
+		assert.Equal(tc.expectedFieldsByTag, sortedFieldsByTag(fieldsInfo), tc.message+" result")
+	}
+
+	tagger := NewTagger([]StringTagger{&emptyStrTagger{}}, nil, nil)
+	tagger.SetFieldTagKey("json")
+	jsonFieldsInfo, err := tagger.TagJson(string(rawJson), nil, nil)
+	assert.Nil(err, "tag json expected error")
+	assert.Equal(tests[0].expectedFieldsByTag, sortedFieldsByTag(jsonFieldsInfo), "same fields of the json")
+}
+
+func TestTagObjectConcurrent(t *testing.T) {
+	assert := assert.New(t)
+	object := struct {
+		StrField string
+		StrArray []string
+		IntArray []int
+		Obj      struct {
+			Float  float64
+			Bool   bool
+			StrMap map[string]string
+		}
+	}{
+		StrField: "some random string",
+		StrArray: []string{"string 1", "string 2", "string 3", "string 4"},
+		IntArray: []int{1, 2, 3, 4, 5, 6},
+	}
+	object.Obj.Float = 42.42
+	object.Obj.StrMap = map[string]string{"key": "value"}
+
+	tests := []struct {
+		workers int
+		message string
+	}{
+		{workers: 2, message: "two workers"},
+		{workers: 8, message: "eight workers"},
+	}
+
+	newTagger := func() *Tagger {
+		return NewTaggerWithBool(
+			[]StringTagger{&emptyStrTagger{}, &namedStrTagger{name: "second"}},
+			[]IntTagger{&emptyIntTagger{}},
+			[]FloatTagger{&emptyFloatTagger{}},
+			[]BoolTagger{&emptyBoolTagger{}},
+		)
+	}
+	expectedFieldsInfo, err := newTagger().TagObject(object, nil, nil)
+	assert.Nil(err, "serial expected error")
+
+	for _, tc := range tests {
+		tagger := newTagger()
+		tagger.SetWorkers(tc.workers)
+		fieldsInfo, err := tagger.TagObject(object, nil, nil)
+		assert.Nil(err, tc.message+" expected error")
+		assert.Equal(expectedFieldsInfo, fieldsInfo, tc.message+" result")
+	}
+}
+
+func TestTagObjectConcurrentError(t *testing.T) {
+	assert := assert.New(t)
+	tagger := NewTagger([]StringTagger{&emptyStrTagger{}, &errStrTagger{}}, nil, nil)
+	tagger.SetWorkers(4)
+	fieldsInfo, err := tagger.TagObject([]string{"string 1", "string 2", "string 3"}, nil, nil)
+	assert.Equal(fmt.Errorf("some tagger error"), err, "expected error")
+	assert.Nil(fieldsInfo, "result")
+}
+
+func TestTagObjectContext(t *testing.T) {
+	assert := assert.New(t)
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		ctx                context.Context
+		workers            int
+		expectedFieldsInfo FieldsInfo
+		expectedErr        error
+		message            string
+	}{
+		{
+			ctx: context.WithValue(context.Background(), ctxTagKey{}, "ctxTag"),
+			expectedFieldsInfo: FieldsInfo{
+				&FieldInfo{
+					Name: "index(0)",
+					Taggers: map[string]TaggerInfo{
+						"ctxStrTagger": {
+							Tags:    []string{"ctxTag"},
+							RunData: nil,
+						},
+					},
+				},
+			},
+			expectedErr: nil,
+			message:     "context value is passed to the tagger",
+		},
+		{
+			ctx:                canceledCtx,
+			expectedFieldsInfo: nil,
+			expectedErr:        context.Canceled,
+			message:            "canceled context",
+		},
+		{
+			ctx:                canceledCtx,
+			workers:            4,
+			expectedFieldsInfo: nil,
+			expectedErr:        context.Canceled,
+			message:            "canceled context with workers",
+		},
+	}
+
+	for _, tc := range tests {
+		tagger := NewContextTagger([]StringContextTagger{&ctxStrTagger{}}, nil, nil, nil)
+		tagger.SetWorkers(tc.workers)
+		fieldsInfo, err := tagger.TagObjectContext(tc.ctx, []string{"some random string"}, nil, nil)
+		assert.Equal(tc.expectedErr, err, tc.message+" expected error")
+		assert.Equal(tc.expectedFieldsInfo, fieldsInfo, tc.message+" result")
+	}
+}
+
+func TestProcessTextContext(t *testing.T) {
+	assert := assert.New(t)
+	tagger, err := NewContextTaggerWithRules(
+		[]StringContextTagger{&ctxStrTagger{}, NewStringContextTagger(&emptyStrTagger{})},
+		nil,
+		nil,
+		nil,
+		map[string][]string{"rule1": {`"ctxTag" and "strTag"`}},
+	)
+	assert.Nil(err, "new tagger expected error")
+
+	ctx := context.WithValue(context.Background(), ctxTagKey{}, "ctxTag")
+	expressionsByRule, err := tagger.ProcessTextContext(ctx, "some random string")
+	assert.Nil(err, "process text expected error")
+	assert.Equal(map[string][]string{"rule1": {`"ctxTag" and "strTag"`}}, expressionsByRule, "process text result")
+
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	expressionsByRule, err = tagger.ProcessTextContext(canceledCtx, "some random string")
+	assert.Equal(context.Canceled, err, "canceled process text expected error")
+	assert.Nil(expressionsByRule, "canceled process text result")
+}
+
+func TestProcessTextCount(t *testing.T) {
+	assert := assert.New(t)
+	tagger, err := NewTaggerWithRules(
+		[]StringTagger{&emptyStrTagger{}},
+		nil,
+		nil,
+		map[string][]string{
+			"found": {`"strTag"`},
+			"count": {`count("strTag") >= 1`, `count("strTag") > 1`, `count("strTag:field1") >= 1`},
+		},
+	)
+	assert.Nil(err, "new tagger expected error")
+
+	expressionsByRule, err := tagger.ProcessText("some random string")
+	assert.Nil(err, "process text expected error")
+	assert.Equal(map[string][]string{
+		"found": {`"strTag"`},
+		"count": {`count("strTag") >= 1`},
+	}, expressionsByRule, "tag of the text is counted once")
+}
+
+func TestTagText(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		text                              string
+		expecterExtractorInfoByTaggerName map[string]TaggerInfo
+		expectedErr                       error
+		message                           string
+	}{
+		{
+			text: `some random string`,
+			expecterExtractorInfoByTaggerName: map[string]TaggerInfo{
+				"emptyStrTagger": {
+					Tags:    []string{"strTag"},
+					RunData: nil,
+				},
+			},
 			expectedErr: nil,
 			message:     "tag text",
 		},
@@ -624,6 +1607,232 @@ func TestEvaluateRules(t *testing.T) {
 	}
 }
 
+func TestEvaluateRulesFieldPathMatching(t *testing.T) {
+	assert := assert.New(t)
+	rulesByName := map[string][]string{
+		"rule1": {`"tag1:user"`},
+	}
+	fieldsByTag := map[string][]string{
+		"tag1": {"username"},
+	}
+
+	tagger, err := NewTaggerWithRules(nil, nil, nil, rulesByName)
+	assert.Nil(err)
+	expressionsByRule, err := tagger.EvaluateRules(fieldsByTag)
+	assert.Nil(err)
+	assert.Equal(map[string][]string{}, expressionsByRule, "segment matching")
+
+	tagger.SetFieldPathMatching(dsl.PrefixMatching)
+	expressionsByRule, err = tagger.EvaluateRules(fieldsByTag)
+	assert.Nil(err)
+	assert.Equal(map[string][]string{"rule1": {`"tag1:user"`}}, expressionsByRule, "prefix matching")
+
+	results, err := tagger.EvaluateRulesDetailed(fieldsByTag)
+	assert.Nil(err)
+	assert.Len(results, 1, "prefix matching detailed")
+	assert.Equal([]TagMatch{{Tag: "tag1", FieldPath: "username"}}, results[0].Matches, "prefix matching detailed")
+}
+
+func TestLeftToRight(t *testing.T) {
+	assert := assert.New(t)
+	expression := `"a" or "b" and "c"`
+	tests := []struct {
+		addRule func(tagger *Tagger) error
+		message string
+	}{
+		{
+			addRule: func(tagger *Tagger) error {
+				return tagger.AddRule("rule1", []string{expression})
+			},
+			message: "add rule",
+		},
+		{
+			addRule: func(tagger *Tagger) error {
+				return tagger.AddRules(map[string][]string{"rule1": {expression}})
+			},
+			message: "add rules",
+		},
+		{
+			addRule: func(tagger *Tagger) error {
+				return tagger.ReplaceRule("rule1", []string{expression})
+			},
+			message: "replace rule",
+		},
+		{
+			addRule: func(tagger *Tagger) error {
+				return tagger.ReloadRules(map[string][]string{"rule1": {expression}})
+			},
+			message: "reload rules",
+		},
+		{
+			addRule: func(tagger *Tagger) error {
+				return tagger.AddRuleDefinitions([]RuleDefinition{{Name: "rule1", Expressions: []string{expression}}})
+			},
+			message: "add rule definitions",
+		},
+	}
+
+	fieldsByTag := map[string][]string{"a": nil}
+	for _, tc := range tests {
+		tagger := NewTagger(nil, nil, nil)
+		assert.Nil(tc.addRule(tagger), tc.message)
+		assert.Equal(map[string][]string{"rule1": {expression}}, mustEvaluate(t, tagger, fieldsByTag), tc.message+" precedence")
+
+		tagger = NewTagger(nil, nil, nil)
+		tagger.SetLeftToRight(true)
+		assert.Nil(tc.addRule(tagger), tc.message)
+		assert.Equal(map[string][]string{}, mustEvaluate(t, tagger, fieldsByTag), tc.message+" left to right")
+	}
+}
+
+func TestEvaluateRulesDetailed(t *testing.T) {
+	assert := assert.New(t)
+	tagger := NewTagger(nil, nil, nil)
+	err := tagger.AddRuleDefinitions([]RuleDefinition{
+		{
+			Name: "rule1",
+			Expressions: []string{
+				`"tag1:field1" and not "tag2"`,
+				`"tag3:field3" or "tag4"`,
+				`"tag5"`,
+			},
+			Severity:    "high",
+			Description: "some description",
+			Labels:      map[string]string{"team": "security"},
+		},
+		{
+			Name:        "rule2",
+			Expressions: []string{`"tag4" and ("tag1" or "tag5")`},
+		},
+	})
+	assert.Nil(err, "add rule definitions")
+	err = tagger.AddRule("rule3", []string{`"tag1:field1.inner"`})
+	assert.Nil(err, "add rule")
+	err = tagger.AddRule("rule4", []string{
+		`atleast(2, "tag3", "tag4", "tag5") and count("tag1:field1") >= 2`,
+		`count("tag2") < 1`,
+	})
+	assert.Nil(err, "add rule with quantifiers")
+
+	results, err := tagger.EvaluateRulesDetailed(map[string][]string{
+		"tag1": {"field1.inner", "field2", "field1"},
+		"tag3": {"field4"},
+		"tag4": {"field5", "field6"},
+	})
+	assert.Nil(err, "evaluate rules detailed")
+
+	type result struct {
+		ruleName         string
+		expressionIndex  int
+		expressionString string
+		metadata         RuleMetadata
+		matches          []TagMatch
+	}
+	var got []result
+	for _, res := range results {
+		assert.NotNil(res.Expression.Expression, res.Expression.ExpressionString)
+		assert.Equal(res.Expression.Expression, res.Explanation.Expression, res.Expression.ExpressionString)
+		assert.True(res.Explanation.Value, res.Expression.ExpressionString)
+		got = append(got, result{
+			ruleName:         res.RuleName,
+			expressionIndex:  res.ExpressionIndex,
+			expressionString: res.Expression.ExpressionString,
+			metadata:         res.Metadata,
+			matches:          res.Matches,
+		})
+	}
+
+	rule1Metadata := RuleMetadata{
+		Severity:    "high",
+		Description: "some description",
+		Labels:      map[string]string{"team": "security"},
+	}
+	assert.Equal([]result{
+		{
+			ruleName:         "rule1",
+			expressionIndex:  0,
+			expressionString: `"tag1:field1" and not "tag2"`,
+			metadata:         rule1Metadata,
+			matches: []TagMatch{
+				{Tag: "tag1", FieldPath: "field1.inner"},
+				{Tag: "tag1", FieldPath: "field1"},
+			},
+		},
+		{
+			ruleName:         "rule1",
+			expressionIndex:  1,
+			expressionString: `"tag3:field3" or "tag4"`,
+			metadata:         rule1Metadata,
+			matches: []TagMatch{
+				{Tag: "tag4", FieldPath: "field5"},
+				{Tag: "tag4", FieldPath: "field6"},
+			},
+		},
+		{
+			ruleName:         "rule2",
+			expressionIndex:  0,
+			expressionString: `"tag4" and ("tag1" or "tag5")`,
+			metadata:         RuleMetadata{},
+			matches: []TagMatch{
+				{Tag: "tag4", FieldPath: "field5"},
+				{Tag: "tag4", FieldPath: "field6"},
+				{Tag: "tag1", FieldPath: "field1.inner"},
+				{Tag: "tag1", FieldPath: "field2"},
+				{Tag: "tag1", FieldPath: "field1"},
+			},
+		},
+		{
+			ruleName:         "rule3",
+			expressionIndex:  0,
+			expressionString: `"tag1:field1.inner"`,
+			metadata:         RuleMetadata{},
+			matches: []TagMatch{
+				{Tag: "tag1", FieldPath: "field1.inner"},
+			},
+		},
+		{
+			ruleName:         "rule4",
+			expressionIndex:  0,
+			expressionString: `atleast(2, "tag3", "tag4", "tag5") and count("tag1:field1") >= 2`,
+			metadata:         RuleMetadata{},
+			matches: []TagMatch{
+				{Tag: "tag3", FieldPath: "field4"},
+				{Tag: "tag4", FieldPath: "field5"},
+				{Tag: "tag4", FieldPath: "field6"},
+				{Tag: "tag1", FieldPath: "field1.inner"},
+				{Tag: "tag1", FieldPath: "field1"},
+			},
+		},
+		{
+			ruleName:         "rule4",
+			expressionIndex:  1,
+			expressionString: `count("tag2") < 1`,
+			metadata:         RuleMetadata{},
+		},
+	}, got, "evaluate rules detailed result")
+}
+
+func TestEvaluateRulesColocation(t *testing.T) {
+	assert := assert.New(t)
+	tagger, err := NewTaggerWithRules(nil, nil, nil, map[string][]string{
+		"customer pii": {`sameparent("name", "ssn:customers", 1)`},
+		"same field":   {`samefield("name", "ssn")`},
+	})
+	assert.Nil(err)
+
+	results, err := tagger.EvaluateRulesDetailed(map[string][]string{
+		"name": {"customers.index(0).name", "customers.index(1).name"},
+		"ssn":  {"customers.index(1).ssn", "employees.index(0).ssn"},
+	})
+	assert.Nil(err)
+	assert.Len(results, 1)
+	assert.Equal("customer pii", results[0].RuleName)
+	assert.Equal([]TagMatch{
+		{Tag: "name", FieldPath: "customers.index(1).name"},
+		{Tag: "ssn", FieldPath: "customers.index(1).ssn"},
+	}, results[0].Matches, "co-located matches")
+}
+
 func TestGetFieldsByTag(t *testing.T) {
 	assert := assert.New(t)
 	tests := []struct {
@@ -695,6 +1904,43 @@ func TestGetFieldsByTag(t *testing.T) {
 	}
 }
 
+// taggerWithRules stores the rules on the tagger, used to build the expected taggers
+func taggerWithRules(tagger *Tagger, rules *ruleSet) *Tagger {
+	tagger.rules.Store(rules)
+	return tagger
+}
+
+// embeddedBase is an unexported struct embedded on the objects of the tests.
+type embeddedBase struct {
+	Email string `json:"email"`
+}
+
+// embeddedName embeds a struct with a name on the struct tag, so its fields are not promoted.
+type embeddedName struct {
+	embeddedBase `json:"base"`
+}
+
+// EmbeddedAudit is an exported struct embedded as a pointer on the objects of the tests.
+type EmbeddedAudit struct {
+	CreatedBy string `json:"createdBy"`
+}
+
+// aliasOuter can point to its first field, that has the same address of the struct.
+type aliasOuter struct {
+	In  aliasInner
+	Ptr *aliasInner
+}
+
+type aliasInner struct {
+	Name string
+}
+
+type selfRefNode struct {
+	Name  string
+	Next  *selfRefNode
+	Other *selfRefNode
+}
+
 type emptyStrTagger struct{}
 
 func (est *emptyStrTagger) IsValid(data string) bool {
@@ -710,6 +1956,59 @@ func (est *emptyStrTagger) GetName() string {
 	return "emptyStrTagger"
 }
 
+type namedStrTagger struct {
+	name string
+}
+
+func (nst *namedStrTagger) IsValid(data string) bool {
+	return true
+}
+
+func (nst *namedStrTagger) GetTags(data string) (tags []string, runData interface{}, err error) {
+	tags = append(tags, nst.name+"Tag")
+	return tags, data, nil
+}
+
+func (nst *namedStrTagger) GetName() string {
+	return nst.name
+}
+
+type errStrTagger struct{}
+
+func (est *errStrTagger) IsValid(data string) bool {
+	return true
+}
+
+func (est *errStrTagger) GetTags(data string) (tags []string, runData interface{}, err error) {
+	return nil, nil, fmt.Errorf("some tagger error")
+}
+
+func (est *errStrTagger) GetName() string {
+	return "errStrTagger"
+}
+
+type ctxTagKey struct{}
+
+type ctxStrTagger struct{}
+
+func (cst *ctxStrTagger) IsValid(data string) bool {
+	return true
+}
+
+func (cst *ctxStrTagger) GetTagsContext(ctx context.Context, data string) (tags []string, runData interface{}, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	if tag, ok := ctx.Value(ctxTagKey{}).(string); ok {
+		tags = append(tags, tag)
+	}
+	return
+}
+
+func (cst *ctxStrTagger) GetName() string {
+	return "ctxStrTagger"
+}
+
 type emptyIntTagger struct{}
 
 func (est *emptyIntTagger) IsValid(data int64) bool {
@@ -739,3 +2038,18 @@ func (est *emptyFloatTagger) GetTags(data float64) (tags []string, runData inter
 func (est *emptyFloatTagger) GetName() string {
 	return "emptyFloatTagger"
 }
+
+type emptyBoolTagger struct{}
+
+func (est *emptyBoolTagger) IsValid(data bool) bool {
+	return true
+}
+
+func (est *emptyBoolTagger) GetTags(data bool) (tags []string, runData interface{}, err error) {
+	tags = append(tags, "boolTag")
+	return
+}
+
+func (est *emptyBoolTagger) GetName() string {
+	return "emptyBoolTagger"
+}